@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/spf13/viper"
 
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/sedyukov/lft-backend/internal/health"
+	"github.com/sedyukov/lft-backend/internal/middleware"
 	"github.com/sedyukov/lft-backend/internal/routes"
 	"github.com/sedyukov/lft-backend/internal/service"
 )
 
+// shutdownTimeout limits waiting for open connections on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Load viper config
 	err := service.LoadConfig()
@@ -26,8 +37,15 @@ func main() {
 	}
 	logger.Info().Msg("Logger sucessfully started for gateway")
 
-	app := fiber.New()
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: middleware.ErrorHandler,
+	})
 	app.Use(cors.New())
+	middleware.Setup(app, logger)
 
 	// Initialize database without migration
 	var migrateDatabase = false
@@ -36,12 +54,40 @@ func main() {
 		panic(err)
 	}
 	logger.Info().Msg("DB init finished")
+	defer lftdb.DBInstance.Close()
 
 	// Setup gateway routes
+	app.Get("/healthz", health.Healthz)
+	app.Get("/readyz", health.Readyz(health.Config{
+		MaxLag:     viper.GetUint64("READY_MAX_LAG"),
+		MaxHeadAge: viper.GetDuration("READY_MAX_HEAD_AGE"),
+	}))
 	routes.SetupGatewayRoutes(app)
 
+	// Metrics are served on a separate admin port
+	if adminPort := viper.GetString("ADMIN_PORT"); adminPort != "" {
+		go service.ServeAdmin(ctx, adminPort, service.NewAdminMux(), logger)
+	}
+
 	// Listening for requests
 	var port = viper.GetString("GATEWAY_PORT")
 	logger.Info().Msgf("Listening to port %v", port)
-	app.Listen(":" + port)
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":" + port)
+	}()
+
+	// Drain connections on shutdown
+	select {
+	case err = <-listenErr:
+		logger.Error().Err(err).Msg("Gateway stopped listening")
+		return
+	case <-ctx.Done():
+	}
+
+	logger.Info().Msg("Shutting down gateway")
+	if err = app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		logger.Error().Err(err).Msg("Gateway shutdown failed")
+	}
+	logger.Info().Msg("Gateway stopped")
 }
@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog"
 	"github.com/sedyukov/lft-backend/internal/blockchain"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/sedyukov/lft-backend/internal/health"
 	"github.com/sedyukov/lft-backend/internal/service"
 	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	parserModeRpc    = "rpc"
+	parserModeWs     = "ws"
+	parserModeHybrid = "hybrid"
+
+	defaultLeaderboardRefresh = 5 * time.Minute
 )
 
 func main() {
@@ -34,67 +52,207 @@ func main() {
 		panic(err)
 	}
 	logger.Info().Msg("DB init sucessfully")
+	defer lftdb.DBInstance.Close()
 
-	establishRpcMonitoring(logger)
-}
-
-func establishWsMonitoring(logger zerolog.Logger) {
-	var (
-		bscWs           = viper.GetString("ENDPOINT_WS")
-		contractAddress = viper.GetString("CONTRACT_ADDRESS")
-	)
-
-	// Init client
-	ctx, cancel := context.WithCancel(context.Background())
-	client, err := ethclient.DialContext(ctx, bscWs)
+	targets, err := loadTargets()
 	if err != nil {
-		logger.Error().Msg("Connection failed to: " + bscWs)
 		panic(err)
 	}
 
-	nId, err := client.NetworkID(ctx)
-	if err != nil {
-		logger.Error().Msg("Connection failed to: " + bscWs)
+	// Monitors finish the batch in progress and stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if port := viper.GetString("METRICS_PORT"); port != "" {
+		mux := service.NewAdminMux()
+		health.Register(mux, health.Config{
+			MaxLag:     viper.GetUint64("READY_MAX_LAG"),
+			MaxHeadAge: viper.GetDuration("READY_MAX_HEAD_AGE"),
+		}, logger)
+		go service.ServeAdmin(ctx, port, mux, logger)
+	}
+
+	// Every target is monitored by its own goroutine, failure of any of them stops the parser
+	group, ctx := errgroup.WithContext(ctx)
+	mode := viper.GetString("PARSER_MODE")
+	for _, t := range targets {
+		t := t
+		targetLogger := logger.With().Uint64("chain_id", t.ChainID).Str("contract", t.Contract).Logger()
+		switch mode {
+		case "", parserModeRpc:
+			group.Go(func() error { return establishRpcMonitoring(ctx, t, targetLogger) })
+		case parserModeWs:
+			group.Go(func() error { return establishWsMonitoring(ctx, t, targetLogger, false) })
+		case parserModeHybrid:
+			group.Go(func() error { return establishWsMonitoring(ctx, t, targetLogger, true) })
+		default:
+			panic("Unknown PARSER_MODE: " + mode)
+		}
+	}
+	group.Go(func() error {
+		refreshLeaderboard(ctx, viper.GetDuration("LEADERBOARD_REFRESH_INTERVAL"), logger)
+		return nil
+	})
+	if err = group.Wait(); err != nil {
+		logger.Error().Err(err).Msg("Monitoring failed")
 		panic(err)
 	}
-	logger.Info().Msg(nId.String())
+	logger.Info().Msg("Parser stopped")
+}
+
+// refreshLeaderboard recalculates the referral leaderboard every interval until the context is cancelled,
+// failed refresh is retried on the next tick
+func refreshLeaderboard(ctx context.Context, interval time.Duration, logger zerolog.Logger) {
+	if interval <= 0 {
+		interval = defaultLeaderboardRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			if err := lftdb.RefreshReferralLeaderboard(ctx); err != nil {
+				if ctx.Err() == nil {
+					logger.Error().Err(err).Msg("Failed to refresh referral leaderboard")
+				}
+				continue
+			}
+			logger.Debug().Dur("duration", time.Since(start)).Msg("Referral leaderboard refreshed")
+		}
+	}
+}
+
+// target is a contract deployment indexed by the parser
+type target struct {
+	// ChainID is checked against the endpoints, requested from them when not set
+	ChainID  uint64   `json:"chain_id"`
+	Rpc      []string `json:"rpc"`
+	Ws       string   `json:"ws"`
+	Contract string   `json:"contract"`
+	// StartBlock seeds the block cursor, the contract deployment block is searched when not set
+	StartBlock uint64 `json:"start_block"`
+	// adoptLegacy is set for the contract indexed before several deployments were supported
+	adoptLegacy bool
+}
+
+// loadTargets reads TARGETS json list, a single target is built from
+// ENDPOINT_RPC, ENDPOINT_WS, CONTRACT_ADDRESS, CHAIN_ID and START_BLOCK when it is not set.
+// Data stored by earlier versions is adopted by the target of CONTRACT_ADDRESS
+func loadTargets() ([]target, error) {
+	var targets []target
+	legacyContract := viper.GetString("CONTRACT_ADDRESS")
+	if raw := viper.GetString("TARGETS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &targets); err != nil {
+			return nil, fmt.Errorf("invalid TARGETS: %w", err)
+		}
+		if len(targets) == 0 {
+			return nil, errors.New("TARGETS list is empty")
+		}
+		for i := range targets {
+			if legacyContract != "" && strings.EqualFold(targets[i].Contract, legacyContract) {
+				targets[i].adoptLegacy = true
+				break
+			}
+		}
+		return targets, nil
+	}
+
+	return []target{{
+		ChainID:     viper.GetUint64("CHAIN_ID"),
+		Rpc:         strings.Split(viper.GetString("ENDPOINT_RPC"), ","),
+		Ws:          viper.GetString("ENDPOINT_WS"),
+		Contract:    legacyContract,
+		StartBlock:  viper.GetUint64("START_BLOCK"),
+		adoptLegacy: true,
+	}}, nil
+}
+
+// establishWsMonitoring processes blocks on new heads from websocket subscription,
+// in hybrid mode events are requested over RPC which is also polled while websocket is down,
+// including the start when the websocket endpoint is not reachable yet
+func establishWsMonitoring(ctx context.Context, t target, logger zerolog.Logger, hybrid bool) error {
+	// Init clients
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	dialWs := func(ctx context.Context) (blockchain.HeadSubscriber, error) {
+		return dialClient(ctx, t.Ws, logger)
+	}
+	var client blockchain.ChainClient
+	if hybrid {
+		pool, err := dialPool(ctx, t.Rpc, logger)
+		if err != nil {
+			return err
+		}
+		client = pool
+	} else {
+		wsClient, err := dialClient(ctx, t.Ws, logger)
+		if err != nil {
+			return err
+		}
+		client = wsClient
+		dialWs = func(context.Context) (blockchain.HeadSubscriber, error) {
+			return wsClient, nil
+		}
+	}
 	logger.Info().Msg("Client init sucessfully")
 
 	// Start monitoring
-	monitor := blockchain.NewMonitor(contractAddress, logger)
-	err = monitor.Start(ctx, client, logger)
+	config := monitorConfig(t)
+	config.PollingFallback = hybrid
+	monitor := blockchain.NewMonitor(config, logger)
+	return monitor.Start(ctx, client, dialWs, logger)
+}
+
+func establishRpcMonitoring(ctx context.Context, t target, logger zerolog.Logger) error {
+	// Init client
+	client, err := dialPool(ctx, t.Rpc, logger)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	logger.Info().Msg("Client init sucessfully")
+
+	// Start monitoring
+	monitor := blockchain.NewMonitor(monitorConfig(t), logger)
+	return monitor.StartRpc(ctx, client, logger)
 }
 
-func establishRpcMonitoring(logger zerolog.Logger) {
-	var (
-		rpcEndpoint     = viper.GetString("ENDPOINT_RPC")
-		contractAddress = viper.GetString("CONTRACT_ADDRESS")
-	)
+func monitorConfig(t target) blockchain.MonitorConfig {
+	return blockchain.MonitorConfig{
+		ChainID:         t.ChainID,
+		ContractAddress: t.Contract,
+		StartBlock:      t.StartBlock,
+		ReorgDepth:      viper.GetUint64("REORG_DEPTH"),
+		Confirmations:   viper.GetUint64("CONFIRMATIONS"),
+		BackfillWorkers: viper.GetInt("BACKFILL_WORKERS"),
+		AdoptLegacy:     t.adoptLegacy,
+	}
+}
 
-	// Init client
-	ctx := context.Background()
-	client, err := ethclient.DialContext(ctx, rpcEndpoint)
+// dialPool connects to the list of rpc endpoints
+func dialPool(ctx context.Context, endpoints []string, logger zerolog.Logger) (*blockchain.ClientPool, error) {
+	pool, err := blockchain.NewClientPool(ctx, endpoints, logger)
 	if err != nil {
-		logger.Error().Msg("Connection failed to: " + rpcEndpoint)
-		panic(err)
+		logger.Error().Msg("Connection failed to all rpc endpoints")
+		return nil, err
 	}
+	return pool, nil
+}
 
-	nId, err := client.NetworkID(ctx)
+func dialClient(ctx context.Context, endpoint string, logger zerolog.Logger) (*ethclient.Client, error) {
+	client, err := ethclient.DialContext(ctx, endpoint)
 	if err != nil {
-		logger.Error().Msg("Connection failed to: " + rpcEndpoint)
-		panic(err)
+		logger.Error().Msg("Connection failed to: " + endpoint)
+		return nil, err
 	}
-	logger.Info().Msg(nId.String())
-	logger.Info().Msg("Client init sucessfully")
 
-	// Start monitoring
-	monitor := blockchain.NewMonitor(contractAddress, logger)
-	err = monitor.StartRpc(ctx, client, logger)
+	nId, err := client.NetworkID(ctx)
 	if err != nil {
-		panic(err)
+		logger.Error().Msg("Connection failed to: " + endpoint)
+		return nil, err
 	}
+	logger.Info().Msg(nId.String())
+	return client, nil
 }
@@ -0,0 +1,95 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error codes returned by the gateway
+const (
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// Error is an API error rendered as JSON by the gateway error handler,
+// the cause of internal errors is logged but never returned to the client
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	cause   error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Response is the JSON body of error responses
+type Response struct {
+	Error ResponseError `json:"error"`
+}
+
+type ResponseError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func BadRequest(message string) *Error {
+	return &Error{Status: fiber.StatusBadRequest, Code: CodeBadRequest, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Status: fiber.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+// Internal hides the cause behind a generic message
+func Internal(cause error) *Error {
+	return &Error{Status: fiber.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", cause: cause}
+}
+
+// From converts any error returned by handlers to the API error,
+// fiber errors keep their status and message, unknown errors become internal
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		if fiberErr.Code >= fiber.StatusInternalServerError {
+			return &Error{Status: fiberErr.Code, Code: codeOf(fiberErr.Code), Message: http.StatusText(fiberErr.Code), cause: err}
+		}
+		return &Error{Status: fiberErr.Code, Code: codeOf(fiberErr.Code), Message: fiberErr.Message}
+	}
+	return Internal(err)
+}
+
+func codeOf(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeBadRequest
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
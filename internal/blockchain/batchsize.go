@@ -0,0 +1,54 @@
+package blockchain
+
+import "sync"
+
+const (
+	minHistoryBlockBatch = 1
+	maxHistoryBlockBatch = 50000
+	// batches with fewer events are considered sparse and the window grows
+	sparseBatchEvents = 100
+	// batches with more events are considered dense and the window shrinks
+	denseBatchEvents = 5000
+)
+
+// batchSizer adapts history batch size to the density of events and provider limits
+type batchSizer struct {
+	mu   sync.Mutex
+	size uint64
+}
+
+func newBatchSizer(size uint64) *batchSizer {
+	return &batchSizer{size: size}
+}
+
+func (b *batchSizer) get() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// adjust grows the window after a sparse batch and shrinks it after a dense one
+func (b *batchSizer) adjust(events int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case events < sparseBatchEvents && b.size < maxHistoryBlockBatch:
+		b.size *= 2
+		if b.size > maxHistoryBlockBatch {
+			b.size = maxHistoryBlockBatch
+		}
+	case events > denseBatchEvents && b.size > minHistoryBlockBatch:
+		b.size /= 2
+	}
+}
+
+// shrink bisects the window after the provider rejected the range, returns false when it can not be reduced
+func (b *batchSizer) shrink() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.size <= minHistoryBlockBatch {
+		return false
+	}
+	b.size /= 2
+	return true
+}
@@ -0,0 +1,34 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchSizerAdjust(t *testing.T) {
+	sizer := newBatchSizer(1000)
+
+	sizer.adjust(0)
+	require.Equal(t, uint64(2000), sizer.get())
+
+	sizer.adjust(denseBatchEvents + 1)
+	require.Equal(t, uint64(1000), sizer.get())
+
+	sizer.adjust(sparseBatchEvents)
+	require.Equal(t, uint64(1000), sizer.get())
+
+	for i := 0; i < 10; i++ {
+		sizer.adjust(0)
+	}
+	require.Equal(t, uint64(maxHistoryBlockBatch), sizer.get())
+}
+
+func TestBatchSizerShrink(t *testing.T) {
+	sizer := newBatchSizer(3)
+
+	require.True(t, sizer.shrink())
+	require.Equal(t, uint64(1), sizer.get())
+	require.False(t, sizer.shrink())
+	require.Equal(t, uint64(1), sizer.get())
+}
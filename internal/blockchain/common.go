@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"regexp"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -16,11 +15,12 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
 	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
+	"github.com/sedyukov/lft-backend/internal/ethaddr"
 )
 
 var (
 	ErrInvalidKey             = errors.New("invalid key")
-	ErrInvalidAddress         = errors.New("invalid address")
+	ErrInvalidAddress         = ethaddr.ErrInvalidAddress
 	ErrInvalidContractAddress = errors.New("invalid contract address")
 )
 
@@ -78,7 +78,7 @@ func getContract(ctx context.Context, client *ethclient.Client, contractAddress
 }
 
 // validateContractAddress validate the contract address checking if the contract is deployed
-func validateContractAddress(ctx context.Context, client *ethclient.Client, address string) error {
+func validateContractAddress(ctx context.Context, client bind.ContractCaller, address string) error {
 	if err := validateAddress(address); err != nil {
 		return err
 	}
@@ -95,11 +95,7 @@ func validateContractAddress(ctx context.Context, client *ethclient.Client, addr
 
 // validateAddress validate address format
 func validateAddress(address string) error {
-	regex := regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
-	if ok := regex.MatchString(address); !ok {
-		return ErrInvalidAddress
-	}
-	return nil
+	return ethaddr.Validate(address)
 }
 
 // etherToWei convert Ether to Wei
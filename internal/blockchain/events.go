@@ -0,0 +1,344 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/sedyukov/lft-backend/internal/ethaddr"
+)
+
+// processBlockRange filters every LevelFiveToken event in [start, end] and stores them
+// in one transaction together with the end block hash and the block cursor,
+// returns the number of stored events
+func (m *monitor) processBlockRange(contract *contracts.ContractFilterer, start uint64, end *types.Header) (int, error) {
+	batch, err := m.fetchSplitRange(contract, start, end.Number.Uint64())
+	if err != nil {
+		return 0, err
+	}
+	return batch.Len(), m.commitBlockRange(batch, end)
+}
+
+// fetchSplitRange fetches events of [start, end], the range is bisected while the provider rejects it
+// and the history batch size is reduced
+func (m *monitor) fetchSplitRange(contract *contracts.ContractFilterer, start uint64, end uint64) (lftdb.Batch, error) {
+	batch, err := m.fetchBlockRange(contract, start, end)
+	if err == nil || !isRangeError(err) || end == start {
+		return batch, err
+	}
+
+	m.batches.shrink()
+	mid := start + (end-start)/2
+	m.logger.Warn().Err(err).Msgf("Range from %d to %d rejected, splitting at %d", start, end, mid)
+	left, err := m.fetchSplitRange(contract, start, mid)
+	if err != nil {
+		return left, err
+	}
+	right, err := m.fetchSplitRange(contract, mid+1, end)
+	if err != nil {
+		return right, err
+	}
+	left.Append(right)
+	return left, nil
+}
+
+// commitBlockRange stores the batch with the end block hash and moves the block cursor to the end block
+func (m *monitor) commitBlockRange(batch lftdb.Batch, end *types.Header) error {
+	defer m.observeBatchStage("commit", time.Now())
+	batch.Deployment = m.deployment
+	batch.Block = lftdb.Block{
+		Number:     end.Number.Uint64(),
+		Hash:       end.Hash().Hex(),
+		ParentHash: end.ParentHash.Hex(),
+	}
+	if err := lftdb.CommitBatch(batch); err != nil {
+		m.logger.Error().Msg("Failed to store events batch")
+		return err
+	}
+	m.observeBatch(batch, end)
+	return m.pruneBlocks(batch.Block.Number)
+}
+
+// fetchBlockRange requests logs of every LevelFiveToken event in [start, end] with a single
+// eth_getLogs call and decodes them into a batch
+func (m *monitor) fetchBlockRange(contract *contracts.ContractFilterer, start uint64, end uint64) (lftdb.Batch, error) {
+	defer m.observeBatchStage("fetch", time.Now())
+	var batch lftdb.Batch
+
+	topics := make([]common.Hash, 0, len(m.handlers))
+	for topic := range m.handlers {
+		topics = append(topics, topic)
+	}
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(start),
+		ToBlock:   new(big.Int).SetUint64(end),
+		Addresses: []common.Address{common.HexToAddress(m.contractAddress)},
+		Topics:    [][]common.Hash{topics},
+	}
+	logs, err := m.client.FilterLogs(m.ctx, query)
+	if err != nil {
+		m.logger.Error().Msg("Get FilterLogs failed")
+		return batch, err
+	}
+
+	for _, raw := range logs {
+		if raw.Removed || len(raw.Topics) == 0 {
+			continue
+		}
+		handler, ok := m.handlers[raw.Topics[0]]
+		if !ok {
+			m.logger.Warn().Msgf("Unknown event topic %s", raw.Topics[0].Hex())
+			continue
+		}
+		if err = handler(m, &batch, contract, raw); err != nil {
+			m.logger.Error().Msgf("Failed to decode log %d of tx %s", raw.Index, raw.TxHash.Hex())
+			return batch, err
+		}
+	}
+	return batch, nil
+}
+
+// processBlockRangeWithRetry retries failed block range so the cursor is never moved over unprocessed blocks
+func (m *monitor) processBlockRangeWithRetry(contract *contracts.ContractFilterer, start uint64, end *types.Header) (int, error) {
+	var err error
+	for attempt := 1; attempt <= BatchRetryAttempts; attempt++ {
+		var events int
+		events, err = m.processBlockRange(contract, start, end)
+		if err == nil {
+			return events, nil
+		}
+		m.logger.Error().Err(err).Msgf("Processing blocks from %d to %d failed, attempt %d", start, end.Number.Uint64(), attempt)
+		if !m.sleep(BatchRetryDelay) {
+			return 0, m.ctx.Err()
+		}
+	}
+	return 0, err
+}
+
+// logHandler decodes the log into a typed event and adds it to the batch
+type logHandler func(m *monitor, batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error
+
+// newLogHandlers maps topic of every LevelFiveToken event to its handler using the contract ABI
+func newLogHandlers() (map[common.Hash]logHandler, error) {
+	contractAbi, err := contracts.ContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]logHandler{
+		"Transfer":             (*monitor).handleTransfer,
+		"Approval":             (*monitor).handleApproval,
+		"Register":             (*monitor).handleRegister,
+		"Stake":                (*monitor).handleStake,
+		"Unstake":              (*monitor).handleUnstake,
+		"RewardReferral":       (*monitor).handleRewardReferral,
+		"RewardStakers":        (*monitor).handleRewardStakers,
+		"OwnershipTransferred": (*monitor).handleOwnershipTransferred,
+	}
+	handlers := make(map[common.Hash]logHandler, len(byName))
+	for name, handler := range byName {
+		event, ok := contractAbi.Events[name]
+		if !ok {
+			return nil, fmt.Errorf("event %s not found in contract abi", name)
+		}
+		handlers[event.ID] = handler
+	}
+	return handlers, nil
+}
+
+func (m *monitor) handleTransfer(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseTransfer(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateTransfer(batch, lftdb.TransferEvent{
+		EventLog:    log,
+		From:        ethaddr.String(event.From),
+		To:          ethaddr.String(event.To),
+		Value:       event.Value,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleApproval(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseApproval(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateApproval(batch, lftdb.ApprovalEvent{
+		EventLog:    log,
+		Owner:       ethaddr.String(event.Owner),
+		Spender:     ethaddr.String(event.Spender),
+		Value:       event.Value,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleRegister(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseRegister(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateRegister(batch, lftdb.RegisterEvent{
+		EventLog:    log,
+		Refferal:    ethaddr.String(event.Referral),
+		Trader:      ethaddr.String(event.Trader),
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleStake(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseStake(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateStake(batch, lftdb.StakeEvent{
+		EventLog:    log,
+		Staker:      ethaddr.String(event.Staker),
+		Amount:      event.Amount,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleUnstake(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseUnstake(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateUnstake(batch, lftdb.UnstakeEvent{
+		EventLog:    log,
+		Staker:      ethaddr.String(event.Staker),
+		Amount:      event.Amount,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleRewardReferral(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseRewardReferral(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateRewardRefferal(batch, lftdb.RewardReferralEvent{
+		EventLog:    log,
+		Trader:      ethaddr.String(event.Trader),
+		Refferal:    ethaddr.String(event.Referral),
+		Level:       event.Level,
+		Amount:      event.Amount,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleRewardStakers(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseRewardStakers(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateRewardStakers(batch, lftdb.RewardStakersEvent{
+		EventLog:    log,
+		Trader:      ethaddr.String(event.Trader),
+		Amount:      event.Amount,
+		BlockNumber: raw.BlockNumber,
+		Status:      m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+func (m *monitor) handleOwnershipTransferred(batch *lftdb.Batch, contract *contracts.ContractFilterer, raw types.Log) error {
+	event, err := contract.ParseOwnershipTransferred(raw)
+	if err != nil {
+		return err
+	}
+	log, err := m.eventLog(raw)
+	if err != nil {
+		return err
+	}
+	lftdb.CreateOwnershipTransferred(batch, lftdb.OwnershipTransferredEvent{
+		EventLog:      log,
+		PreviousOwner: ethaddr.String(event.PreviousOwner),
+		NewOwner:      ethaddr.String(event.NewOwner),
+		BlockNumber:   raw.BlockNumber,
+		Status:        m.eventStatus(raw.BlockNumber),
+	})
+	return nil
+}
+
+// eventStatus returns confirmed status for events having enough confirmations
+func (m *monitor) eventStatus(blockNumber uint64) string {
+	if blockNumber+m.confirmations <= m.head {
+		return lftdb.StatusConfirmed
+	}
+	return lftdb.StatusPending
+}
+
+// confirmEvents marks events which got enough confirmations since the last head as confirmed
+func (m *monitor) confirmEvents() error {
+	if m.head < m.confirmations {
+		return nil
+	}
+	err := lftdb.ConfirmEvents(m.deployment, m.head-m.confirmations)
+	if err != nil {
+		m.logger.Error().Msg("Failed to confirm events")
+	}
+	return err
+}
+
+// eventLog returns on chain identity and time of the event log
+func (m *monitor) eventLog(raw types.Log) (lftdb.EventLog, error) {
+	header, err := m.headerByHash(raw.BlockHash)
+	if err != nil {
+		return lftdb.EventLog{}, err
+	}
+	return lftdb.EventLog{
+		ChainID:         m.deployment.ChainID,
+		ContractAddress: m.deployment.ContractAddress,
+		TxHash:          raw.TxHash.Hex(),
+		LogIndex:        raw.Index,
+		TxIndex:         raw.TxIndex,
+		BlockHash:       raw.BlockHash.Hex(),
+		BlockTime:       time.Unix(int64(header.Time), 0).UTC(),
+	}, nil
+}
@@ -0,0 +1,28 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogHandlers(t *testing.T) {
+	handlers, err := newLogHandlers()
+	require.NoError(t, err)
+	require.Len(t, handlers, 8)
+
+	for _, signature := range []string{
+		"Transfer(address,address,uint256)",
+		"Approval(address,address,uint256)",
+		"Register(address,address)",
+		"Stake(address,uint256)",
+		"Unstake(address,uint256)",
+		"RewardReferral(address,address,uint8,uint256)",
+		"RewardStakers(address,uint256)",
+		"OwnershipTransferred(address,address)",
+	} {
+		_, ok := handlers[crypto.Keccak256Hash([]byte(signature))]
+		require.True(t, ok, signature)
+	}
+}
@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const headerCacheSize = 256
+
+// headerCache keeps recently used block headers by hash, hashes stay valid across chain reorganizations
+type headerCache struct {
+	mu      sync.Mutex
+	size    int
+	headers map[common.Hash]*types.Header
+	order   []common.Hash
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:    size,
+		headers: make(map[common.Hash]*types.Header, size),
+		order:   make([]common.Hash, 0, size),
+	}
+}
+
+func (c *headerCache) get(hash common.Hash) (*types.Header, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header, ok := c.headers[hash]
+	return header, ok
+}
+
+func (c *headerCache) add(header *types.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash := header.Hash()
+	if _, ok := c.headers[hash]; ok {
+		return
+	}
+	// evict the oldest header
+	if len(c.order) >= c.size {
+		delete(c.headers, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.headers[hash] = header
+	c.order = append(c.order, hash)
+}
+
+// headerByHash returns block header using the cache
+func (m *monitor) headerByHash(hash common.Hash) (*types.Header, error) {
+	if header, ok := m.headers.get(hash); ok {
+		return header, nil
+	}
+	header, err := m.client.HeaderByHash(m.ctx, hash)
+	if err != nil {
+		m.logger.Error().Msgf("Failed to fetch header %s", hash.Hex())
+		return nil, err
+	}
+	m.headers.add(header)
+	return header, nil
+}
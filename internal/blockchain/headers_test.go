@@ -0,0 +1,29 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderCacheEvictsOldest(t *testing.T) {
+	cache := newHeaderCache(2)
+	headers := []*types.Header{
+		{Number: big.NewInt(1)},
+		{Number: big.NewInt(2)},
+		{Number: big.NewInt(3)},
+	}
+	for _, header := range headers {
+		cache.add(header)
+	}
+
+	_, ok := cache.get(headers[0].Hash())
+	require.False(t, ok)
+	for _, header := range headers[1:] {
+		cached, ok := cache.get(header.Hash())
+		require.True(t, ok)
+		require.Equal(t, header.Number, cached.Number)
+	}
+}
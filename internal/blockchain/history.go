@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"golang.org/x/sync/errgroup"
+)
+
+type historyRange struct {
+	start uint64
+	end   uint64
+}
+
+type historyBatch struct {
+	historyRange
+	header *types.Header
+	batch  lftdb.Batch
+}
+
+// processHistory processes blocks in [from, to) by history batches fetched concurrently by workers,
+// batches are committed and the block cursor is moved strictly in block order.
+// When the monitor is stopped batches fetched in order so far are still committed
+func (m *monitor) processHistory(contract *contracts.ContractFilterer, from uint64, to uint64) error {
+	if from >= to {
+		return nil
+	}
+
+	g, ctx := errgroup.WithContext(m.ctx)
+	ranges := make(chan historyRange)
+	fetched := make(chan historyBatch, m.backfillWorkers)
+	// limits batches kept in memory while waiting for the previous ones to be committed
+	inflight := make(chan struct{}, 2*m.backfillWorkers)
+
+	g.Go(func() error {
+		defer close(ranges)
+		for i := from; i < to; {
+			end := i + m.batches.get() - 1
+			if end >= to {
+				end = to - 1
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case inflight <- struct{}{}:
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case ranges <- historyRange{start: i, end: end}:
+			}
+			i = end + 1
+		}
+		return nil
+	})
+
+	var workers sync.WaitGroup
+	for w := 0; w < m.backfillWorkers; w++ {
+		workers.Add(1)
+		g.Go(func() error {
+			defer workers.Done()
+			for r := range ranges {
+				b, err := m.fetchHistory(contract, r)
+				if err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case fetched <- b:
+				}
+			}
+			return nil
+		})
+	}
+	go func() {
+		workers.Wait()
+		close(fetched)
+	}()
+
+	g.Go(func() error {
+		pending := make(map[uint64]historyBatch)
+		next := from
+		for b := range fetched {
+			pending[b.start] = b
+			for b, ok := pending[next]; ok; b, ok = pending[next] {
+				delete(pending, next)
+				if err := m.commitHistory(b); err != nil {
+					return err
+				}
+				<-inflight
+				next = b.end + 1
+			}
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// fetchHistoryBatch fetches events and the end block header of the range
+func (m *monitor) fetchHistoryBatch(contract *contracts.ContractFilterer, r historyRange) (historyBatch, error) {
+	batch, err := m.fetchHistoryRange(contract, r.start, r.end)
+	if err != nil {
+		return historyBatch{}, err
+	}
+	header := m.fetchBlock(int64(r.end))
+	if header == nil {
+		return historyBatch{}, ErrFetchBlock
+	}
+	return historyBatch{historyRange: r, header: header, batch: batch}, nil
+}
+
+// fetchHistoryRange fetches events of [start, end] retrying failures
+func (m *monitor) fetchHistoryRange(contract *contracts.ContractFilterer, start uint64, end uint64) (lftdb.Batch, error) {
+	var err error
+	for attempt := 1; attempt <= BatchRetryAttempts; attempt++ {
+		var batch lftdb.Batch
+		batch, err = m.fetchSplitRange(contract, start, end)
+		if err == nil {
+			return batch, nil
+		}
+		m.logger.Error().Err(err).Msgf("Fetching blocks from %d to %d failed, attempt %d", start, end, attempt)
+		if !m.sleep(BatchRetryDelay) {
+			return lftdb.Batch{}, m.ctx.Err()
+		}
+	}
+	return lftdb.Batch{}, err
+}
+
+// commitHistoryBatch stores fetched batch retrying failures
+func (m *monitor) commitHistoryBatch(b historyBatch) error {
+	var err error
+	for attempt := 1; attempt <= BatchRetryAttempts; attempt++ {
+		if err = m.commitBlockRange(b.batch, b.header); err == nil {
+			break
+		}
+		m.logger.Error().Err(err).Msgf("Storing blocks from %d to %d failed, attempt %d", b.start, b.end, attempt)
+		if !m.sleep(BatchRetryDelay) {
+			return m.ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info().Msgf(
+		fmt.Sprintf("Fetched batch from %d to %d", b.start, b.end),
+	)
+
+	m.batches.adjust(b.batch.Len())
+	return m.confirmEvents()
+}
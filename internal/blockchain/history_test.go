@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
+	"github.com/stretchr/testify/require"
+)
+
+func newHistoryMonitor(workers int, batch uint64) *monitor {
+	m := NewMonitor(MonitorConfig{BackfillWorkers: workers}, zerolog.Nop()).(*monitor)
+	m.ctx = context.Background()
+	m.batches = newBatchSizer(batch)
+	return m
+}
+
+func TestProcessHistoryCommitsInOrder(t *testing.T) {
+	m := newHistoryMonitor(3, 10)
+
+	// the first range is fetched last, after a later range has been fetched
+	later := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	var fetched []uint64
+	m.fetchHistory = func(_ *contracts.ContractFilterer, r historyRange) (historyBatch, error) {
+		if r.start == 100 {
+			<-later
+		}
+		mu.Lock()
+		fetched = append(fetched, r.start)
+		mu.Unlock()
+		if r.start != 100 {
+			once.Do(func() { close(later) })
+		}
+		return historyBatch{historyRange: r}, nil
+	}
+	var committed []historyRange
+	m.commitHistory = func(b historyBatch) error {
+		committed = append(committed, b.historyRange)
+		return nil
+	}
+
+	require.NoError(t, m.processHistory(nil, 100, 195))
+	require.NotEqual(t, uint64(100), fetched[0])
+	require.Len(t, committed, 10)
+	next := uint64(100)
+	for _, r := range committed {
+		require.Equal(t, next, r.start)
+		next = r.end + 1
+	}
+	require.Equal(t, uint64(195), next)
+}
+
+func TestProcessHistoryStopsOnCommitError(t *testing.T) {
+	m := newHistoryMonitor(2, 10)
+	m.fetchHistory = func(_ *contracts.ContractFilterer, r historyRange) (historyBatch, error) {
+		return historyBatch{historyRange: r}, nil
+	}
+	failed := errors.New("commit failed")
+	var committed []uint64
+	m.commitHistory = func(b historyBatch) error {
+		if b.start == 120 {
+			return failed
+		}
+		committed = append(committed, b.start)
+		return nil
+	}
+
+	require.ErrorIs(t, m.processHistory(nil, 100, 200), failed)
+	require.Equal(t, []uint64{100, 110}, committed)
+}
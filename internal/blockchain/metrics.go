@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+const (
+	metricsNamespace = "lft_parser"
+	// headStoreInterval is how often the unchanged chain head is stored to show the parser is alive
+	headStoreInterval = 30 * time.Second
+)
+
+var (
+	deploymentLabels = []string{"chain_id", "contract"}
+
+	chainHeadGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "chain_head",
+		Help:      "Latest known chain head block",
+	}, deploymentLabels)
+	indexedBlockGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "indexed_block",
+		Help:      "Last block stored by the parser",
+	}, deploymentLabels)
+	lagBlocksGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "lag_blocks",
+		Help:      "Number of blocks between the chain head and the last indexed block",
+	}, deploymentLabels)
+	lagSecondsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "lag_seconds",
+		Help:      "Age of the last indexed block at the moment it was stored",
+	}, deploymentLabels)
+	eventsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_total",
+		Help:      "Number of stored contract events by type",
+	}, append(deploymentLabels, "event"))
+	batchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "batch_duration_seconds",
+		Help:      "Duration of fetching and storing block range batches",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, append(deploymentLabels, "stage"))
+	reorgsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reorgs_total",
+		Help:      "Number of chain reorganizations rolled back",
+	}, deploymentLabels)
+
+	rpcRequestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_requests_total",
+		Help:      "Number of RPC requests by endpoint and method",
+	}, []string{"endpoint", "method"})
+	rpcErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_errors_total",
+		Help:      "Number of failed RPC requests by endpoint and method",
+	}, []string{"endpoint", "method"})
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_request_duration_seconds",
+		Help:      "Latency of RPC requests by endpoint and method",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+)
+
+// metricLabels returns label values identifying the monitored deployment
+func (m *monitor) metricLabels(extra ...string) []string {
+	return append([]string{strconv.FormatUint(m.deployment.ChainID, 10), m.deployment.ContractAddress}, extra...)
+}
+
+// setHead remembers the latest known chain head and stores it for readiness checks,
+// the unchanged head is stored again every headStoreInterval
+func (m *monitor) setHead(head uint64) {
+	if head <= m.head && time.Since(m.headStoredAt) < headStoreInterval {
+		return
+	}
+	if head > m.head {
+		m.head = head
+		chainHeadGauge.WithLabelValues(m.metricLabels()...).Set(float64(m.head))
+	}
+	if err := lftdb.UpdateHead(m.deployment, m.head); err != nil {
+		m.logger.Error().Err(err).Msg("Failed to store chain head")
+		return
+	}
+	m.headStoredAt = time.Now()
+}
+
+// observeBatch records the stored batch, its end block and the indexer lag
+func (m *monitor) observeBatch(batch lftdb.Batch, end *types.Header) {
+	labels := m.metricLabels()
+	number := end.Number.Uint64()
+	indexedBlockGauge.WithLabelValues(labels...).Set(float64(number))
+	if m.head > number {
+		lagBlocksGauge.WithLabelValues(labels...).Set(float64(m.head - number))
+	} else {
+		lagBlocksGauge.WithLabelValues(labels...).Set(0)
+	}
+	lagSecondsGauge.WithLabelValues(labels...).Set(time.Since(time.Unix(int64(end.Time), 0)).Seconds())
+
+	for event, count := range map[string]int{
+		"Approval":             len(batch.Approvals),
+		"OwnershipTransferred": len(batch.OwnershipTransferreds),
+		"Register":             len(batch.Registers),
+		"RewardReferral":       len(batch.RewardReferrals),
+		"RewardStakers":        len(batch.RewardStakers),
+		"Stake":                len(batch.Stakes),
+		"Transfer":             len(batch.Transfers),
+		"Unstake":              len(batch.Unstakes),
+	} {
+		if count > 0 {
+			eventsCounter.WithLabelValues(m.metricLabels(event)...).Add(float64(count))
+		}
+	}
+}
+
+// observeBatchStage records duration of the batch stage started at the given time
+func (m *monitor) observeBatchStage(stage string, start time.Time) {
+	batchDuration.WithLabelValues(m.metricLabels(stage)...).Observe(time.Since(start).Seconds())
+}
+
+// observeRpc records the result of the RPC request to the endpoint
+func observeRpc(endpoint string, method string, latency time.Duration, err error) {
+	rpcRequestsCounter.WithLabelValues(endpoint, method).Inc()
+	rpcDuration.WithLabelValues(endpoint, method).Observe(latency.Seconds())
+	if err != nil {
+		rpcErrorsCounter.WithLabelValues(endpoint, method).Inc()
+	}
+}
+
+// endpointLabel returns the endpoint host, so api keys in the url path or query are not exposed
+func endpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
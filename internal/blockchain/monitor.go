@@ -2,40 +2,79 @@ package blockchain
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math/big"
-	"strconv"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/rs/zerolog"
 	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
-	lftcontrollers "github.com/sedyukov/lft-backend/internal/controllers/lft"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
-	"golang.org/x/sync/errgroup"
+	"github.com/sedyukov/lft-backend/internal/ethaddr"
 )
 
 const (
-	TxReceiptsBatchSize = 16
-	RequestTimeout      = 32 * time.Second
-	RequestRetryDelay   = 32 * time.Millisecond
-	historyBlockBatch   = 1000
+	TxReceiptsBatchSize    = 16
+	RequestTimeout         = 32 * time.Second
+	RequestRetryDelay      = 32 * time.Millisecond
+	historyBlockBatch      = 1000
+	DefaultReorgDepth      = 64
+	DefaultBackfillWorkers = 4
+	BatchRetryAttempts     = 5
+	BatchRetryDelay        = 1 * time.Second
 )
 
 // Monitor interface
 type Monitor interface {
-	Start(ctx context.Context, client *ethclient.Client, logger zerolog.Logger) error
-	StartRpc(ctx context.Context, client *ethclient.Client, logger zerolog.Logger) error
+	Start(ctx context.Context, client ChainClient, dialWs HeadDialer, logger zerolog.Logger) error
+	StartRpc(ctx context.Context, client ChainClient, logger zerolog.Logger) error
+}
+
+// MonitorConfig holds monitor settings
+type MonitorConfig struct {
+	// ChainID of the indexed chain, requested from the client when not set
+	ChainID         uint64
+	ContractAddress string
+	// StartBlock is the first block processed when the deployment has no stored cursor yet
+	StartBlock uint64
+	// ReorgDepth is the maximum number of blocks that can be rolled back on chain reorganization
+	ReorgDepth uint64
+	// Confirmations is the number of blocks on top of the event block required to confirm it
+	Confirmations uint64
+	// PollingFallback enables polling for new blocks while websocket subscription is down
+	PollingFallback bool
+	// BackfillWorkers is the number of history batches fetched concurrently
+	BackfillWorkers int
+	// AdoptLegacy hands the block counter and events stored before indexing of several deployments
+	// over to this deployment, it must be set only for the contract indexed by earlier versions
+	AdoptLegacy bool
 }
 
 type monitor struct {
-	contractAddress string
-	client          ethclient.Client
-	logger          zerolog.Logger
+	chainID          uint64
+	contractAddress  string
+	startBlock       uint64
+	deployment       lftdb.Deployment
+	reorgDepth       uint64
+	confirmations    uint64
+	pollingFallback  bool
+	resubscribeDelay time.Duration
+	pollInterval     time.Duration
+	backfillWorkers  int
+	adoptLegacy      bool
+	head             uint64
+	headStoredAt     time.Time
+	headers          *headerCache
+	batches          *batchSizer
+	handlers         map[common.Hash]logHandler
+	blocks           blockStore
+	// fetchHistory and commitHistory are stages of processHistory
+	fetchHistory  func(contract *contracts.ContractFilterer, r historyRange) (historyBatch, error)
+	commitHistory func(b historyBatch) error
+	ctx           context.Context
+	client        ChainClient
+	logger        zerolog.Logger
 }
 
 // AllowanceChangedEvent struct
@@ -47,150 +86,250 @@ type monitor struct {
 // 	BlockNumber uint64   `json:"block_number"`
 // }
 
-// OwnershipTransferredEvent struct
-type OwnershipTransferredEvent struct {
-	Event         string    `json:"event_type"`
-	PreviousOwner string    `json:"previous_owner"`
-	NewOwner      string    `json:"new_owner"`
-	BlockNumber   uint64    `json:"block_number"`
-	Timestamp     time.Time `json:"timestamp"`
-}
-
 // NewMonitor returns a new runner instance
-func NewMonitor(contractAddress string, logger zerolog.Logger) Monitor {
-	return &monitor{
-		contractAddress: contractAddress,
+func NewMonitor(config MonitorConfig, logger zerolog.Logger) Monitor {
+	reorgDepth := config.ReorgDepth
+	if reorgDepth == 0 {
+		reorgDepth = DefaultReorgDepth
+	}
+	backfillWorkers := config.BackfillWorkers
+	if backfillWorkers <= 0 {
+		backfillWorkers = DefaultBackfillWorkers
+	}
+	m := &monitor{
+		chainID:          config.ChainID,
+		contractAddress:  config.ContractAddress,
+		startBlock:       config.StartBlock,
+		reorgDepth:       reorgDepth,
+		confirmations:    config.Confirmations,
+		pollingFallback:  config.PollingFallback,
+		resubscribeDelay: ResubscribeDelay,
+		pollInterval:     HeadPollInterval,
+		backfillWorkers:  backfillWorkers,
+		adoptLegacy:      config.AdoptLegacy,
+		headers:          newHeaderCache(headerCacheSize),
+		batches:          newBatchSizer(historyBlockBatch),
+		blocks:           dbBlockStore{},
+		logger:           logger,
 	}
+	m.fetchHistory = m.fetchHistoryBatch
+	m.commitHistory = m.commitHistoryBatch
+	return m
 }
 
-// Start register to listen blockchain events
-func (m *monitor) Start(ctx context.Context, client *ethclient.Client, logger zerolog.Logger) error {
-	m.client = *client
-	m.logger = logger
+// StartRpc stores the history and then follows the chain head polled every HeadPollInterval,
+// it keeps waiting for new blocks however slow the chain is until the context is cancelled
+func (m *monitor) StartRpc(ctx context.Context, client ChainClient, logger zerolog.Logger) error {
 	logger.Info().Msgf("Start monitoring at %s", m.contractAddress)
 
-	err := validateContractAddress(ctx, client, m.contractAddress)
+	contract, err := m.prepare(ctx, client, logger)
 	if err != nil {
-		logger.Error().Msg("Contract address validation failed")
 		return err
 	}
 
-	contract, err := contracts.NewContract(common.HexToAddress(m.contractAddress), client)
+	i, err := m.backfill(contract)
 	if err != nil {
-		logger.Error().Msg("Contract creation failed")
-		return err
+		return m.stopped(err)
 	}
-	logger.Info().Msg("Contract instance created successfully")
-	eg := new(errgroup.Group)
-	eg.Go(func() error {
-		return m.watchRewardReferralEvent(ctx, contract)
-	})
-	eg.Go(func() error {
-		return m.watchOwnershipTransferred(ctx, contract)
-	})
-	if err = eg.Wait(); err != nil {
-		logger.Error().Msg("Events error group throw error")
-		return err
+
+	_, err = m.pollHeads(ctx, contract, i, time.Time{})
+	return m.stopped(err)
+}
+
+// stopped returns nil instead of the error caused by the monitor context cancellation,
+// the block cursor always points to the last committed batch so there is nothing left to store
+func (m *monitor) stopped(err error) error {
+	if err != nil && m.ctx.Err() != nil {
+		m.logger.Info().Msg("Monitoring stopped")
+		return nil
 	}
-	return nil
+	return err
 }
 
-func (m *monitor) StartRpc(ctx context.Context, client *ethclient.Client, logger zerolog.Logger) error {
-	logger.Info().Msgf("Start monitoring at %s", m.contractAddress)
+// sleep waits for the given duration, false is returned if the monitor is stopped meanwhile
+func (m *monitor) sleep(d time.Duration) bool {
+	select {
+	case <-m.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// prepare binds the monitor to the client and creates the contract instance
+func (m *monitor) prepare(ctx context.Context, client ChainClient, logger zerolog.Logger) (*contracts.ContractFilterer, error) {
+	m.ctx = ctx
+	m.client = client
 
-	m.client = *client
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		logger.Error().Msg("Failed when retrieving chain id")
+		return nil, err
+	}
+	if m.chainID != 0 && m.chainID != chainID.Uint64() {
+		return nil, fmt.Errorf("client chain id %d differs from configured %d", chainID.Uint64(), m.chainID)
+	}
+	m.deployment = lftdb.Deployment{
+		ChainID:         chainID.Uint64(),
+		ContractAddress: ethaddr.String(common.HexToAddress(m.contractAddress)),
+	}
+	logger = logger.With().
+		Uint64("chain_id", m.deployment.ChainID).
+		Str("contract", m.deployment.ContractAddress).
+		Logger()
 	m.logger = logger
 
-	err := validateContractAddress(ctx, client, m.contractAddress)
+	err = validateContractAddress(ctx, client, m.contractAddress)
 	if err != nil {
 		logger.Error().Msg("Contract address validation failed")
-		return err
+		return nil, err
 	}
 
-	hexedAddress := common.HexToAddress(m.contractAddress)
-
-	contract, err := contracts.NewContract(hexedAddress, client)
+	contract, err := contracts.NewContractFilterer(common.HexToAddress(m.contractAddress), client)
 	if err != nil {
 		logger.Error().Msg("Contract creation failed")
-		return err
+		return nil, err
+	}
+	m.handlers, err = newLogHandlers()
+	if err != nil {
+		logger.Error().Msg("Contract events decoding setup failed")
+		return nil, err
 	}
 	logger.Info().Msg("Contract instance created successfully")
+	return contract, nil
+}
 
-	header, err := client.HeaderByNumber(context.Background(), nil)
+// backfill processes blocks from the stored cursor up to the current head
+// and returns the next block to process
+func (m *monitor) backfill(contract *contracts.ContractFilterer) (uint64, error) {
+	header, err := m.client.HeaderByNumber(m.ctx, nil)
 	if err != nil {
-		logger.Error().Msg("Failed when retrieving last block")
-		return err
+		m.logger.Error().Msg("Failed when retrieving last block")
+		return 0, err
 	}
 	currentBlock := header.Number.Uint64()
+	m.setHead(currentBlock)
 
-	lastBlockFromDb, err := strconv.ParseInt(lftdb.GetLastBlock(), 0, 64)
+	blockStart, err := m.initCursor(currentBlock)
 	if err != nil {
-		logger.Error().Msg("Failed when trying to convert last parsed block to int")
-		return err
+		return 0, err
 	}
-	blockStart := uint64(lastBlockFromDb)
-
-	if blockStart < currentBlock {
-		for i := blockStart; i < currentBlock; i += historyBlockBatch {
-			currentBlockEnd := i + historyBlockBatch - 1
 
-			if currentBlockEnd >= currentBlock {
-				currentBlockEnd = currentBlock - 1
-			}
-
-			query := &bind.FilterOpts{
-				Start: i,
-				End:   &currentBlockEnd,
-			}
-
-			eventsIterator, err := contract.FilterRewardReferral(query, nil, nil, nil)
-			if err != nil {
-				logger.Error().Msg("Get FilterRewardReferral failed")
-				return err
-			}
+	end := m.historyEnd(currentBlock)
+	if blockStart >= end {
+		return blockStart, nil
+	}
+	if err = m.processHistory(contract, blockStart, end); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
 
-			m.logger.Info().Msgf(
-				fmt.Sprintf("Fetched batch from %d to %d", i, currentBlockEnd),
-			)
+// historyEnd returns the block where history batches stop below the head, blocks from it up to the head
+// are processed by syncTo, so hashes of blocks which can still be reorganized are stored closely enough
+// to find the fork point, history batches keep only hashes of their end blocks
+func (m *monitor) historyEnd(head uint64) uint64 {
+	tail := m.reorgDepth
+	if m.confirmations > tail {
+		tail = m.confirmations
+	}
+	if head <= tail {
+		return 0
+	}
+	return head - tail
+}
 
-			m.parseRewardReferralEvent(eventsIterator)
-			lftdb.UpdateLastBlock(strconv.FormatUint(currentBlockEnd, 10))
+// syncTo processes blocks from next up to head and returns the next block to process,
+// long gaps are processed by history batches up to historyEnd, blocks up to the confirmed head
+// as a single range and the rest one by one to keep their hashes for chain reorganization detection
+func (m *monitor) syncTo(contract *contracts.ContractFilterer, next uint64, head uint64) (uint64, error) {
+	m.setHead(head)
+	if end := m.historyEnd(head); head > next+historyBlockBatch && end > next {
+		if err := m.processHistory(contract, next, end); err != nil {
+			return next, err
 		}
+		next = end
 	}
-
-	for i := currentBlock; true; i++ {
-		block := m.fetchBlock(int64(i))
-
+	if m.confirmations > 0 && head >= next+m.confirmations {
+		var err error
+		next, err = m.processConfirmedRange(contract, next, head-m.confirmations)
+		if err != nil {
+			return next, err
+		}
+	}
+	for next <= head && m.ctx.Err() == nil {
+		block := m.fetchBlock(int64(next))
 		if block == nil {
-			return nil
+			return next, ErrFetchBlock
 		}
-
-		endBlock := currentBlock + 1
-		logger.Info().Uint64("endBlock", endBlock)
-		query := &bind.FilterOpts{
-			Start: i,
-			End:   &i,
+		var err error
+		next, err = m.processHeader(contract, block)
+		if err != nil {
+			return next, err
 		}
+	}
+	return next, nil
+}
 
-		eventsIterator, err := contract.FilterRewardReferral(query, nil, nil, nil)
-		if err != nil {
-			logger.Error().Msg("Get FilterRewardReferral failed")
-			return err
+// processHeader stores events of a single block rolling back reorganized blocks first,
+// returns the next block to process
+func (m *monitor) processHeader(contract *contracts.ContractFilterer, block *types.Header) (uint64, error) {
+	m.setHead(block.Number.Uint64())
+	return m.processRange(contract, block, block)
+}
+
+// processConfirmedRange stores events of [start, end] with a single request, returns the next block to process
+func (m *monitor) processConfirmedRange(contract *contracts.ContractFilterer, start uint64, end uint64) (uint64, error) {
+	first := m.fetchBlock(int64(start))
+	if first == nil {
+		return start, ErrFetchBlock
+	}
+	last := first
+	if end > start {
+		if last = m.fetchBlock(int64(end)); last == nil {
+			return start, ErrFetchBlock
 		}
+	}
+	return m.processRange(contract, first, last)
+}
+
+// processRange stores events from the first block up to the last one rolling back reorganized blocks first,
+// returns the next block to process
+func (m *monitor) processRange(contract *contracts.ContractFilterer, first *types.Header, last *types.Header) (uint64, error) {
+	i := first.Number.Uint64()
 
-		m.parseRewardReferralEvent(eventsIterator)
-		lftdb.UpdateLastBlock(strconv.FormatUint(i, 10))
+	forkBlock, reorged, err := m.detectReorg(first)
+	if err != nil {
+		return i, err
+	}
+	if reorged {
+		m.logger.Warn().Msgf("Chain reorganization detected at %d, rolling back to %d", i, forkBlock)
+		reorgsCounter.WithLabelValues(m.metricLabels()...).Inc()
+		if err = lftdb.Rollback(m.deployment, forkBlock); err != nil {
+			m.logger.Error().Msg("Rollback after chain reorganization failed")
+			return i, err
+		}
+		// continue from the block following the fork point
+		return forkBlock + 1, nil
 	}
 
-	return nil
+	_, err = m.processBlockRangeWithRetry(contract, i, last)
+	if err != nil {
+		return i, err
+	}
+	if err = m.confirmEvents(); err != nil {
+		return i, err
+	}
+	return last.Number.Uint64() + 1, nil
 }
 
 func (m *monitor) fetchBlock(height int64) *types.Header {
 	// Request until get block
 	for first, start, deadline := true, time.Now(), time.Now().Add(RequestTimeout); true; first = false {
 		// Request block
-		result, err := m.client.HeaderByNumber(context.Background(), new(big.Int).SetInt64(height))
+		result, err := m.client.HeaderByNumber(m.ctx, new(big.Int).SetInt64(height))
 		if err == nil {
+			m.headers.add(result)
 			if !first {
 				m.logger.Info().Msgf(
 					fmt.Sprintf("Fetched block (after %s), height %d", DurationToString(time.Since(start)), height),
@@ -204,101 +343,14 @@ func (m *monitor) fetchBlock(height int64) *types.Header {
 		}
 		// Stop trying when the deadline is reached
 		if time.Now().After(deadline) {
+			m.logger.Error().Err(err).Msgf("Failed to fetch block %d in %s", height, DurationToString(RequestTimeout))
 			return nil
 		}
 		// Sleep some time before next try
-		time.Sleep(RequestRetryDelay)
-	}
-
-	return nil
-}
-
-func (m *monitor) watchRewardReferralEvent(ctx context.Context, contract *contracts.Contract) error {
-	events := make(chan *contracts.ContractRewardReferral)
-	opts := &bind.WatchOpts{
-		Start:   nil,
-		Context: ctx,
-	}
-	subscription, err := contract.WatchRewardReferral(opts, events, nil, nil, nil)
-	if err != nil {
-		return err
-	}
-	defer subscription.Unsubscribe()
-
-	for {
-		select {
-		case <-ctx.Done():
+		if !m.sleep(RequestRetryDelay) {
 			return nil
-		case errChan := <-subscription.Err():
-			return errChan
-		case event := <-events:
-			j, _ := json.MarshalIndent(
-				lftcontrollers.RewardReferralEvent{
-					Trader:      event.Trader.Hex(),
-					Refferal:    event.Referral.Hex(),
-					Level:       event.Level,
-					Amount:      event.Amount,
-					BlockNumber: event.Raw.BlockNumber,
-				},
-				"",
-				"  ",
-			)
-			fmt.Println(string(j))
 		}
 	}
-}
-
-func (m *monitor) watchOwnershipTransferred(ctx context.Context, contract *contracts.Contract) error {
-	events := make(chan *contracts.ContractOwnershipTransferred)
-	opts := &bind.WatchOpts{
-		Start:   nil,
-		Context: ctx,
-	}
-	subscription, err := contract.WatchOwnershipTransferred(opts, events, nil, nil)
-	if err != nil {
-		return err
-	}
-	defer subscription.Unsubscribe()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case errChan := <-subscription.Err():
-			return errChan
-		case event := <-events:
-			j, _ := json.MarshalIndent(
-				OwnershipTransferredEvent{
-					Event:         "OwnershipTransferred",
-					PreviousOwner: event.PreviousOwner.Hex(),
-					NewOwner:      event.NewOwner.Hex(),
-					BlockNumber:   event.Raw.BlockNumber,
-					Timestamp:     time.Now(),
-				},
-				"",
-				"  ",
-			)
-			fmt.Println(string(j))
-		}
-	}
-}
-
-func (m *monitor) parseRewardReferralEvent(eventsIterator *contracts.ContractRewardReferralIterator) error {
-	for eventsIterator.Next() {
-		event := eventsIterator.Event
-		rre := lftcontrollers.RewardReferralEvent{
-			Trader:      event.Trader.Hex(),
-			Refferal:    event.Referral.Hex(),
-			Level:       event.Level,
-			Amount:      event.Amount,
-			BlockNumber: event.Raw.BlockNumber,
-		}
-		lftcontrollers.CreateRewardRefferal(rre)
-	}
-
-	if eventsIterator.Error() != nil {
-		return eventsIterator.Error()
-	}
 
 	return nil
 }
@@ -0,0 +1,356 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/rs/zerolog"
+)
+
+const (
+	HealthCheckInterval = 10 * time.Second
+	ErrorCooldown       = 5 * time.Second
+	RateLimitCooldown   = 30 * time.Second
+	// MaxHeadLag is the number of blocks an endpoint can be behind the best known head
+	MaxHeadLag = 5
+	// RangeLimitTTL is how long the block range limit of an endpoint is kept before larger ranges are tried again
+	RangeLimitTTL = 10 * time.Minute
+	// scoreSmoothing is the weight of the latest sample in endpoint latency and error rate
+	scoreSmoothing = 0.2
+)
+
+var ErrNoEndpoints = errors.New("no rpc endpoints available")
+
+// ChainClient is the part of ethclient.Client used by the monitor
+type ChainClient interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+}
+
+// ClientPool routes requests to the healthiest of several RPC endpoints
+// and rotates to the next one when an endpoint fails, rate limits or lags behind the head
+type ClientPool struct {
+	mu        sync.Mutex
+	endpoints []*poolEndpoint
+	head      uint64
+	logger    zerolog.Logger
+}
+
+type poolEndpoint struct {
+	url           string
+	label         string
+	client        *ethclient.Client
+	latency       time.Duration
+	errorRate     float64
+	head          uint64
+	cooldownUntil time.Time
+	// maxRange is the largest block range accepted by the endpoint in FilterLogs until maxRangeUntil, 0 when unknown
+	maxRange      uint64
+	maxRangeUntil time.Time
+}
+
+// NewClientPool dials every endpoint and starts periodic health checks,
+// unreachable endpoints are skipped
+func NewClientPool(ctx context.Context, urls []string, logger zerolog.Logger) (*ClientPool, error) {
+	p := &ClientPool{logger: logger}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			logger.Error().Err(err).Msg("Connection failed to: " + url)
+			continue
+		}
+		p.endpoints = append(p.endpoints, &poolEndpoint{url: url, label: endpointLabel(url), client: client})
+	}
+	if len(p.endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	p.checkHealth(ctx)
+	go func() {
+		ticker := time.NewTicker(HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.checkHealth(ctx)
+			}
+		}
+	}()
+	return p, nil
+}
+
+// checkHealth requests the latest header from every endpoint to update scores and heads
+func (p *ClientPool) checkHealth(ctx context.Context) {
+	for _, e := range p.endpoints {
+		start := time.Now()
+		header, err := e.client.HeaderByNumber(ctx, nil)
+		p.report(e, "HealthCheck", time.Since(start), err)
+		if err == nil {
+			p.updateHead(e, header.Number.Uint64())
+		}
+	}
+}
+
+// pick returns the best scored endpoint skipping excluded, cooling down and lagging ones when possible
+func (p *ClientPool) pick(excluded map[*poolEndpoint]bool) *poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best, fallback *poolEndpoint
+	for _, e := range p.endpoints {
+		if excluded[e] {
+			continue
+		}
+		if fallback == nil || e.cooldownUntil.Before(fallback.cooldownUntil) {
+			fallback = e
+		}
+		if now.Before(e.cooldownUntil) || e.head+MaxHeadLag < p.head {
+			continue
+		}
+		if best == nil || e.score() < best.score() {
+			best = e
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return fallback
+}
+
+// score is the expected latency penalized by the error rate, lower is better
+func (e *poolEndpoint) score() float64 {
+	return float64(e.latency) * (1 + 10*e.errorRate)
+}
+
+// report updates endpoint latency and error rate with the result of a call,
+// rejected logs ranges are the caller's issue and don't count as endpoint failures
+func (p *ClientPool) report(e *poolEndpoint, method string, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if errors.Is(err, ethereum.NotFound) {
+		err = nil
+	}
+	observeRpc(e.label, method, latency, err)
+	failed := 0.0
+	if err != nil && !isRangeError(err) {
+		failed = 1
+		cooldown := ErrorCooldown
+		if isRateLimited(err) {
+			cooldown = RateLimitCooldown
+		}
+		e.cooldownUntil = time.Now().Add(cooldown)
+	}
+	e.errorRate = e.errorRate*(1-scoreSmoothing) + failed*scoreSmoothing
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(float64(e.latency)*(1-scoreSmoothing) + float64(latency)*scoreSmoothing)
+	}
+}
+
+func (p *ClientPool) updateHead(e *poolEndpoint, head uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.head = head
+	if head > p.head {
+		p.head = head
+	}
+}
+
+// call runs request on the best endpoint rotating to the next one on failure,
+// rejected logs ranges are returned to the caller to reduce the range
+func (p *ClientPool) call(ctx context.Context, method string, request func(e *poolEndpoint) error) error {
+	excluded := make(map[*poolEndpoint]bool, len(p.endpoints))
+	var err error
+	for e := p.pick(excluded); e != nil; e = p.pick(excluded) {
+		start := time.Now()
+		err = request(e)
+		p.report(e, method, time.Since(start), err)
+		if err == nil || errors.Is(err, ethereum.NotFound) || isRangeError(err) || ctx.Err() != nil {
+			return err
+		}
+		p.logger.Warn().Err(err).Msgf("%s failed at %s, rotating endpoint", method, e.url)
+		excluded[e] = true
+	}
+	return err
+}
+
+// isRateLimited checks whether the provider refused the request because of rate limits
+func isRateLimited(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "429") ||
+		strings.Contains(message, "rate limit") ||
+		strings.Contains(message, "too many requests")
+}
+
+// isRangeError checks whether the provider refused logs request because of block range or result limits
+func isRangeError(err error) bool {
+	return isBlockRangeLimit(err) || containsAny(err, []string{
+		"query returned more than",
+		"too many results",
+		"logs matched by query exceeds",
+		"response size exceeded",
+	})
+}
+
+// isBlockRangeLimit checks whether the provider refused logs request because of its block range limit,
+// unlike result limits it doesn't depend on the density of events
+func isBlockRangeLimit(err error) bool {
+	return containsAny(err, []string{
+		"block range",
+		"range too large",
+		"range is too large",
+		"exceed maximum block range",
+	})
+}
+
+func containsAny(err error, patterns []string) bool {
+	message := strings.ToLower(err.Error())
+	for _, pattern := range patterns {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ClientPool) ChainID(ctx context.Context) (*big.Int, error) {
+	var id *big.Int
+	err := p.call(ctx, "ChainID", func(e *poolEndpoint) error {
+		var err error
+		id, err = e.client.ChainID(ctx)
+		return err
+	})
+	return id, err
+}
+
+func (p *ClientPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := p.call(ctx, "HeaderByNumber", func(e *poolEndpoint) error {
+		var err error
+		header, err = e.client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (p *ClientPool) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	var header *types.Header
+	err := p.call(ctx, "HeaderByHash", func(e *poolEndpoint) error {
+		var err error
+		header, err = e.client.HeaderByHash(ctx, hash)
+		return err
+	})
+	return header, err
+}
+
+func (p *ClientPool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	var code []byte
+	err := p.call(ctx, "CodeAt", func(e *poolEndpoint) error {
+		var err error
+		code, err = e.client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+func (p *ClientPool) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := p.call(ctx, "CallContract", func(e *poolEndpoint) error {
+		var err error
+		result, err = e.client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (p *ClientPool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := p.call(ctx, "FilterLogs", func(e *poolEndpoint) error {
+		var err error
+		logs, err = p.filterLogs(ctx, e, query)
+		return err
+	})
+	return logs, err
+}
+
+// filterLogs splits the query by the known endpoint block range limit, when the endpoint rejects
+// the block range half of it is remembered as the limit for RangeLimitTTL and the error is returned
+func (p *ClientPool) filterLogs(ctx context.Context, e *poolEndpoint, query ethereum.FilterQuery) ([]types.Log, error) {
+	if query.FromBlock == nil || query.ToBlock == nil {
+		return e.client.FilterLogs(ctx, query)
+	}
+
+	var logs []types.Log
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	for from <= to {
+		end := to
+		if limit := p.maxRange(e); limit > 0 && end-from+1 > limit {
+			end = from + limit - 1
+		}
+
+		part := query
+		part.FromBlock = new(big.Int).SetUint64(from)
+		part.ToBlock = new(big.Int).SetUint64(end)
+		result, err := e.client.FilterLogs(ctx, part)
+		if err != nil && isBlockRangeLimit(err) && end > from {
+			limit := (end - from + 1) / 2
+			p.setMaxRange(e, limit)
+			p.logger.Warn().Err(err).Msgf("Block range limited to %d at %s", limit, e.url)
+		}
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, result...)
+		from = end + 1
+	}
+	return logs, nil
+}
+
+// maxRange returns the block range limit of the endpoint, 0 when it is unknown or expired
+func (p *ClientPool) maxRange(e *poolEndpoint) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().After(e.maxRangeUntil) {
+		e.maxRange = 0
+	}
+	return e.maxRange
+}
+
+func (p *ClientPool) setMaxRange(e *poolEndpoint, limit uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.maxRange = limit
+	e.maxRangeUntil = time.Now().Add(RangeLimitTTL)
+}
+
+func (p *ClientPool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var subscription ethereum.Subscription
+	err := p.call(ctx, "SubscribeFilterLogs", func(e *poolEndpoint) error {
+		var err error
+		subscription, err = e.client.SubscribeFilterLogs(ctx, query, ch)
+		return err
+	})
+	return subscription, err
+}
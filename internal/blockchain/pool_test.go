@@ -0,0 +1,48 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPoolPick(t *testing.T) {
+	fast := &poolEndpoint{url: "fast", latency: 10 * time.Millisecond, head: 100}
+	slow := &poolEndpoint{url: "slow", latency: 50 * time.Millisecond, head: 100}
+	lagging := &poolEndpoint{url: "lagging", latency: time.Millisecond, head: 100 - MaxHeadLag - 1}
+	p := &ClientPool{endpoints: []*poolEndpoint{slow, lagging, fast}, head: 100}
+
+	require.Equal(t, fast, p.pick(nil))
+
+	// failed endpoint cools down and the next healthy one is used
+	p.report(fast, "HeaderByNumber", 10*time.Millisecond, errors.New("429 Too Many Requests"))
+	require.True(t, fast.cooldownUntil.After(time.Now().Add(ErrorCooldown)))
+	require.Equal(t, slow, p.pick(nil))
+
+	// excluded endpoints are skipped, unhealthy ones are used as the last resort
+	picked := p.pick(map[*poolEndpoint]bool{slow: true})
+	require.NotNil(t, picked)
+	require.NotEqual(t, slow, picked)
+	require.Nil(t, p.pick(map[*poolEndpoint]bool{slow: true, fast: true, lagging: true}))
+}
+
+func TestClientPoolRangeErrors(t *testing.T) {
+	e := &poolEndpoint{url: "range", latency: 10 * time.Millisecond}
+	p := &ClientPool{endpoints: []*poolEndpoint{e}}
+
+	// rejected ranges don't cool the endpoint down
+	p.report(e, "FilterLogs", 10*time.Millisecond, errors.New("query returned more than 10000 results"))
+	p.report(e, "FilterLogs", 10*time.Millisecond, errors.New("exceed maximum block range: 5000"))
+	require.True(t, e.cooldownUntil.IsZero())
+	require.Zero(t, e.errorRate)
+
+	// only block range limits are remembered and they expire
+	require.True(t, isBlockRangeLimit(errors.New("exceed maximum block range: 5000")))
+	require.False(t, isBlockRangeLimit(errors.New("query returned more than 10000 results")))
+	p.setMaxRange(e, 2500)
+	require.Equal(t, uint64(2500), p.maxRange(e))
+	e.maxRangeUntil = time.Now().Add(-time.Second)
+	require.Zero(t, p.maxRange(e))
+}
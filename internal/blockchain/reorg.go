@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+var (
+	ErrReorgTooDeep = errors.New("chain reorganization is deeper than allowed depth")
+	ErrFetchBlock   = errors.New("failed to fetch block")
+)
+
+// blockStore keeps hashes of processed blocks of the deployment
+type blockStore interface {
+	GetBlock(d lftdb.Deployment, number uint64) (lftdb.Block, bool)
+	GetBlocksDesc(d lftdb.Deployment, from uint64, to uint64) ([]lftdb.Block, error)
+}
+
+// dbBlockStore reads block hashes stored in the database
+type dbBlockStore struct{}
+
+func (dbBlockStore) GetBlock(d lftdb.Deployment, number uint64) (lftdb.Block, bool) {
+	return lftdb.GetBlock(d, number)
+}
+
+func (dbBlockStore) GetBlocksDesc(d lftdb.Deployment, from uint64, to uint64) ([]lftdb.Block, error) {
+	return lftdb.GetBlocksDesc(d, from, to)
+}
+
+// pruneBlocks removes stored block hashes which can not be reorganized anymore
+func (m *monitor) pruneBlocks(number uint64) error {
+	if number <= m.reorgDepth {
+		return nil
+	}
+	err := lftdb.PruneBlocks(m.deployment, number-m.reorgDepth)
+	if err != nil {
+		m.logger.Error().Msg("Failed to prune stored blocks")
+	}
+	return err
+}
+
+// detectReorg compares parent hash of the header with the stored one
+// and returns the last common block when they don't match
+func (m *monitor) detectReorg(header *types.Header) (uint64, bool, error) {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return 0, false, nil
+	}
+	parent, found := m.blocks.GetBlock(m.deployment, number-1)
+	if !found || parent.Hash == header.ParentHash.Hex() {
+		return 0, false, nil
+	}
+
+	forkBlock, err := m.findForkBlock(number - 1)
+	if err != nil {
+		return 0, false, err
+	}
+	return forkBlock, true, nil
+}
+
+// findForkBlock walks back stored blocks starting from the given one
+// until a block matching the canonical chain is found
+func (m *monitor) findForkBlock(from uint64) (uint64, error) {
+	var lowest uint64
+	if from > m.reorgDepth {
+		lowest = from - m.reorgDepth
+	}
+
+	stored, err := m.blocks.GetBlocksDesc(m.deployment, lowest, from)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range stored {
+		canonical := m.fetchBlock(int64(b.Number))
+		if canonical == nil {
+			return 0, ErrFetchBlock
+		}
+		if canonical.Hash().Hex() == b.Hash {
+			return b.Number, nil
+		}
+	}
+
+	m.logger.Error().Msgf("No common block found between %d and %d", lowest, from)
+	return 0, ErrReorgTooDeep
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChain serves headers of the canonical chain by number
+type fakeChain struct {
+	ChainClient
+	headers map[uint64]*types.Header
+}
+
+// newFakeChain builds headers from 0 up to head, blocks from forkAt on are marked by the fork id
+func newFakeChain(head uint64, forkAt uint64, fork byte) *fakeChain {
+	c := &fakeChain{headers: make(map[uint64]*types.Header)}
+	parent := common.Hash{}
+	for n := uint64(0); n <= head; n++ {
+		h := &types.Header{Number: new(big.Int).SetUint64(n), ParentHash: parent, Difficulty: big.NewInt(1)}
+		if n >= forkAt {
+			h.Extra = []byte{fork}
+		}
+		c.headers[n] = h
+		parent = h.Hash()
+	}
+	return c
+}
+
+func (c *fakeChain) HeaderByNumber(_ context.Context, number *big.Int) (*types.Header, error) {
+	h, ok := c.headers[number.Uint64()]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return h, nil
+}
+
+// memBlockStore keeps block hashes in memory
+type memBlockStore map[uint64]lftdb.Block
+
+func (s memBlockStore) store(c *fakeChain, numbers ...uint64) {
+	for _, n := range numbers {
+		h := c.headers[n]
+		s[n] = lftdb.Block{Number: n, Hash: h.Hash().Hex(), ParentHash: h.ParentHash.Hex()}
+	}
+}
+
+func (s memBlockStore) GetBlock(_ lftdb.Deployment, number uint64) (lftdb.Block, bool) {
+	b, ok := s[number]
+	return b, ok
+}
+
+func (s memBlockStore) GetBlocksDesc(_ lftdb.Deployment, from uint64, to uint64) ([]lftdb.Block, error) {
+	var bs []lftdb.Block
+	for n, b := range s {
+		if n >= from && n <= to {
+			bs = append(bs, b)
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Number > bs[j].Number })
+	return bs, nil
+}
+
+func newReorgMonitor(client ChainClient, blocks blockStore) *monitor {
+	m := NewMonitor(MonitorConfig{ReorgDepth: 64, Confirmations: 15}, zerolog.Nop()).(*monitor)
+	m.ctx = context.Background()
+	m.client = client
+	m.blocks = blocks
+	return m
+}
+
+func TestDetectReorg(t *testing.T) {
+	const head = 1000
+	old := newFakeChain(head, head+1, 0)
+
+	// blocks stored after backfill: history end below the reorg depth and the tail one by one
+	stored := memBlockStore{}
+	m := newReorgMonitor(nil, stored)
+	historyEnd := m.historyEnd(head)
+	require.Equal(t, uint64(head-64), historyEnd)
+	stored.store(old, historyEnd-1)
+	for n := historyEnd; n <= head; n++ {
+		stored.store(old, n)
+	}
+
+	// header continuing the stored chain
+	m.client = old
+	_, reorged, err := m.detectReorg(old.headers[head])
+	require.NoError(t, err)
+	require.False(t, reorged)
+
+	// one block reorg of the tip
+	tip := newFakeChain(head+1, head, 1)
+	m.client = tip
+	fork, reorged, err := m.detectReorg(tip.headers[head+1])
+	require.NoError(t, err)
+	require.True(t, reorged)
+	require.Equal(t, uint64(head-1), fork)
+
+	// reorg deeper than the per block tail is resolved by the history end block
+	deep := newFakeChain(head+1, historyEnd+1, 2)
+	m.client = deep
+	fork, reorged, err = m.detectReorg(deep.headers[head+1])
+	require.NoError(t, err)
+	require.True(t, reorged)
+	require.Equal(t, historyEnd, fork)
+
+	// no stored block within the reorg depth matches the canonical chain
+	tooDeep := newFakeChain(head+1, historyEnd-100, 3)
+	m.client = tooDeep
+	_, _, err = m.detectReorg(tooDeep.headers[head+1])
+	require.ErrorIs(t, err, ErrReorgTooDeep)
+}
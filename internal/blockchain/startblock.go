@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+// initCursor returns the last processed block of the deployment seeding the block counter first
+// when it is not stored yet, the configured start block is used or the contract deployment block is searched
+func (m *monitor) initCursor(head uint64) (uint64, error) {
+	if block, found := lftdb.GetLastBlock(m.deployment); found {
+		return block, nil
+	}
+
+	if m.adoptLegacy && m.startBlock == 0 {
+		adopted, err := lftdb.AdoptLegacyLastBlock(m.deployment)
+		if err != nil {
+			m.logger.Error().Msg("Failed to adopt legacy block counter")
+			return 0, err
+		}
+		if block, found := lftdb.GetLastBlock(m.deployment); adopted && found {
+			return block, nil
+		}
+	}
+
+	start := m.startBlock
+	if start == 0 {
+		m.logger.Info().Msg("Start block is not set, searching for the contract deployment block")
+		var err error
+		start, err = findDeploymentBlock(m.ctx, m.client, common.HexToAddress(m.contractAddress), head)
+		if err != nil {
+			m.logger.Error().Msg("Failed to find the contract deployment block")
+			return 0, err
+		}
+		m.logger.Info().Msgf("Contract deployed at block %d", start)
+	}
+
+	if err := lftdb.InitLastBlock(m.deployment, start); err != nil {
+		m.logger.Error().Msg("Failed to init block counter")
+		return 0, err
+	}
+	return start, nil
+}
+
+// findDeploymentBlock binary searches the first block up to head where the contract has code,
+// the client has to serve historical state
+func findDeploymentBlock(ctx context.Context, client bind.ContractCaller, address common.Address, head uint64) (uint64, error) {
+	hasCode := func(block uint64) (bool, error) {
+		code, err := client.CodeAt(ctx, address, new(big.Int).SetUint64(block))
+		return len(code) > 0, err
+	}
+
+	deployed, err := hasCode(head)
+	if err != nil {
+		return 0, err
+	}
+	if !deployed {
+		return 0, ErrInvalidContractAddress
+	}
+
+	low, high := uint64(0), head
+	for low < high {
+		mid := low + (high-low)/2
+		deployed, err = hasCode(mid)
+		if err != nil {
+			return 0, err
+		}
+		if deployed {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
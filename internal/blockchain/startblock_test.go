@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// deployedCaller returns code for blocks starting from the deployment block
+type deployedCaller struct {
+	deployedAt uint64
+	calls      int
+}
+
+func (c *deployedCaller) CodeAt(_ context.Context, _ common.Address, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+	if blockNumber.Uint64() < c.deployedAt {
+		return nil, nil
+	}
+	return []byte{0x60}, nil
+}
+
+func (c *deployedCaller) CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func TestFindDeploymentBlock(t *testing.T) {
+	for _, deployedAt := range []uint64{0, 1, 12345, 1000000} {
+		caller := &deployedCaller{deployedAt: deployedAt}
+		block, err := findDeploymentBlock(context.Background(), caller, common.Address{}, 1000000)
+		require.NoError(t, err)
+		require.Equal(t, deployedAt, block)
+		require.LessOrEqual(t, caller.calls, 22)
+	}
+
+	_, err := findDeploymentBlock(context.Background(), &deployedCaller{deployedAt: 11}, common.Address{}, 10)
+	require.ErrorIs(t, err, ErrInvalidContractAddress)
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/rs/zerolog"
+	contracts "github.com/sedyukov/lft-backend/contracts/interfaces"
+)
+
+const (
+	ResubscribeDelay = 5 * time.Second
+	HeadPollInterval = 3 * time.Second
+)
+
+// HeadSubscriber subscribes to new chain heads, it is implemented by the websocket ethclient.Client
+type HeadSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// HeadDialer connects to the websocket endpoint
+type HeadDialer func(ctx context.Context) (HeadSubscriber, error)
+
+// Start processes blocks on new heads received by the websocket subscription of the client returned by dialWs,
+// events are requested with client and stored the same way as by StartRpc. The websocket endpoint is dialed
+// again until it is connected, so it may be down at start. Blocks missed while the subscription is down are
+// filled from the last stored block once it is restored, with polling fallback they are processed by polling
+// client meanwhile.
+func (m *monitor) Start(ctx context.Context, client ChainClient, dialWs HeadDialer, logger zerolog.Logger) error {
+	logger.Info().Msgf("Start monitoring at %s", m.contractAddress)
+
+	contract, err := m.prepare(ctx, client, logger)
+	if err != nil {
+		return err
+	}
+
+	next, err := m.backfill(contract)
+	if err != nil {
+		return m.stopped(err)
+	}
+	return m.stopped(m.followChain(ctx, contract, dialWs, next))
+}
+
+// followChain follows new heads from the websocket subscription starting with the next block,
+// the dialed client is kept as it reconnects by itself
+func (m *monitor) followChain(ctx context.Context, contract *contracts.ContractFilterer, dialWs HeadDialer, next uint64) error {
+	var wsClient HeadSubscriber
+	for {
+		if wsClient == nil {
+			var err error
+			if wsClient, err = dialWs(ctx); err != nil {
+				m.logger.Error().Err(err).Msg("Websocket connection failed")
+				wsClient = nil
+			}
+		}
+		if wsClient != nil {
+			var err error
+			if next, err = m.followHeads(ctx, contract, wsClient, next); err != nil {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if m.pollingFallback {
+			m.logger.Warn().Msg("Websocket subscription is down, polling for new blocks")
+			var err error
+			next, err = m.pollHeads(ctx, contract, next, time.Now().Add(m.resubscribeDelay))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(m.resubscribeDelay):
+		}
+	}
+}
+
+// followHeads processes blocks up to every new head until the subscription fails
+// and returns the next block to process
+func (m *monitor) followHeads(ctx context.Context, contract *contracts.ContractFilterer, wsClient HeadSubscriber, next uint64) (uint64, error) {
+	heads := make(chan *types.Header)
+	subscription, err := wsClient.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("Subscription to new heads failed")
+		return next, nil
+	}
+	defer subscription.Unsubscribe()
+	m.logger.Info().Msg("Subscribed to new heads")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return next, nil
+		case err = <-subscription.Err():
+			m.logger.Error().Err(err).Msg("Subscription to new heads dropped")
+			return next, nil
+		case head := <-heads:
+			next, err = m.syncTo(contract, next, head.Number.Uint64())
+			if err = m.checkSyncError(err); err != nil {
+				return next, err
+			}
+		}
+	}
+}
+
+// pollHeads processes blocks up to the chain head requested every HeadPollInterval until the deadline,
+// zero deadline polls until the context is cancelled, returns the next block to process
+func (m *monitor) pollHeads(ctx context.Context, contract *contracts.ContractFilterer, next uint64, until time.Time) (uint64, error) {
+	for until.IsZero() || time.Now().Before(until) {
+		head, err := m.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			m.logger.Error().Err(err).Msg("Failed when retrieving last block")
+		} else {
+			next, err = m.syncTo(contract, next, head.Number.Uint64())
+			if err = m.checkSyncError(err); err != nil {
+				return next, err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return next, nil
+		case <-time.After(m.pollInterval):
+		}
+	}
+	return next, nil
+}
+
+// checkSyncError logs sync error and returns it only when the monitor can not proceed,
+// other blocks are retried on the next head
+func (m *monitor) checkSyncError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrReorgTooDeep) {
+		return err
+	}
+	m.logger.Error().Err(err).Msg("Blocks sync failed, retrying on the next head")
+	return nil
+}
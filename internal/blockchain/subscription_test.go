@@ -0,0 +1,68 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// pollingChain counts head requests of polling, the head is never available
+type pollingChain struct {
+	ChainClient
+	polls atomic.Int32
+}
+
+func (c *pollingChain) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	c.polls.Add(1)
+	return nil, errors.New("head is not available")
+}
+
+// subscribeFunc subscribes to new heads with the function
+type subscribeFunc func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+
+func (f subscribeFunc) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return f(ctx, ch)
+}
+
+func TestFollowChainPollsWhileWebsocketIsDown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chain := &pollingChain{}
+	m := NewMonitor(MonitorConfig{PollingFallback: true}, zerolog.Nop()).(*monitor)
+	m.ctx = ctx
+	m.client = chain
+	m.resubscribeDelay = 10 * time.Millisecond
+	m.pollInterval = time.Millisecond
+
+	// the websocket endpoint is down at start and comes up on the third dial
+	var dials int
+	var pollsBeforeSubscription int32
+	dialWs := func(context.Context) (HeadSubscriber, error) {
+		dials++
+		if dials < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return subscribeFunc(func(context.Context, chan<- *types.Header) (ethereum.Subscription, error) {
+			pollsBeforeSubscription = chain.polls.Load()
+			cancel()
+			return event.NewSubscription(func(quit <-chan struct{}) error {
+				<-quit
+				return nil
+			}), nil
+		}), nil
+	}
+
+	require.NoError(t, m.followChain(ctx, nil, dialWs, 100))
+	require.Equal(t, 3, dials)
+	require.Greater(t, pollsBeforeSubscription, int32(1))
+}
@@ -0,0 +1,55 @@
+package lftcontrollers
+
+import (
+	"math/big"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+type AddressSummaryResponse struct {
+	Address string `json:"address"`
+	lftdb.AddressActivity
+	ReferralRewards        string                        `json:"referral_rewards"`
+	ReferralRewardsByLevel []lftdb.RewardSumLevelsResult `json:"referral_rewards_by_level"`
+	Upline                 []lftdb.ReferralMember        `json:"upline"`
+	Downline               []lftdb.ReferralLevelCount    `json:"downline"`
+}
+
+// GetAddressSummary returns rewards, staking totals, referral tree and activity range of the address
+func GetAddressSummary(c *fiber.Ctx) error {
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	filter, err := referralFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	eventFilter := lftdb.EventFilter{Deployment: filter.Deployment, Status: filter.Status}
+	res := AddressSummaryResponse{Address: address}
+
+	if res.AddressActivity, err = lftdb.GetAddressActivity(eventFilter, address); err != nil {
+		return apierror.Internal(err)
+	}
+	if res.ReferralRewardsByLevel, err = lftdb.GetSumRewardsByRefAddressAndLevels(eventFilter, address); err != nil {
+		return apierror.Internal(err)
+	}
+	total := new(big.Int)
+	for _, level := range res.ReferralRewardsByLevel {
+		if sum, ok := new(big.Int).SetString(level.Sum, 10); ok {
+			total.Add(total, sum)
+		}
+	}
+	res.ReferralRewards = total.String()
+
+	if res.Upline, err = lftdb.GetReferralUpline(filter, address); err != nil {
+		return apierror.Internal(err)
+	}
+	if res.Downline, err = lftdb.GetReferralDownlineCounts(filter, address); err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(res)
+}
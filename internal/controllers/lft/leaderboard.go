@@ -0,0 +1,44 @@
+package lftcontrollers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+// GetReferralLeaderboard returns referrers ranked by referral rewards over the period, rewards of all levels
+// are counted unless the level is given
+func GetReferralLeaderboard(c *fiber.Ctx) error {
+	var filter lftdb.LeaderboardFilter
+	deployment, err := deploymentQuery(c)
+	if err != nil {
+		return err
+	}
+	filter.Deployment = deployment
+
+	switch period := c.Query("period", lftdb.PeriodAll); period {
+	case lftdb.PeriodDay, lftdb.PeriodWeek, lftdb.PeriodMonth, lftdb.PeriodAll:
+		filter.Period = period
+	default:
+		return apierror.BadRequest("period must be one of: 24h, 7d, 30d, all")
+	}
+
+	level, err := levelQuery(c)
+	if err != nil {
+		return err
+	}
+	if level != nil {
+		filter.Level = *level
+	}
+
+	limit, err := limitQuery(c)
+	if err != nil {
+		return err
+	}
+	leaderboard, err := lftdb.GetReferralLeaderboard(filter, limit)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(leaderboard)
+}
@@ -3,18 +3,34 @@ package lftcontrollers
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/sedyukov/lft-backend/internal/apierror"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
 )
 
 func GetAllOwnershipTransferred(c *fiber.Ctx) error {
-	var ots = lftdb.GetAllOwnershipTransferred()
-	c.JSON(ots)
-	return nil
+	filter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	ots, err := lftdb.GetAllOwnershipTransferred(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(ots)
 }
 
 func GetOwnershipTransferred(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var ot = lftdb.GetOwnershipTransferred(id)
-	c.JSON(ot)
-	return nil
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	ot, err := lftdb.GetOwnershipTransferred(id)
+	if err != nil {
+		return recordError(err, "ownership transfer")
+	}
+	return c.JSON(ot)
 }
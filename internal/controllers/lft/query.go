@@ -0,0 +1,223 @@
+package lftcontrollers
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/sedyukov/lft-backend/internal/ethaddr"
+)
+
+// eventFilterQuery reads event list filters from query parameters
+func eventFilterQuery(c *fiber.Ctx) (lftdb.EventFilter, error) {
+	var filter lftdb.EventFilter
+
+	deployment, err := deploymentQuery(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Deployment = deployment
+
+	status, err := statusQuery(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Status = status
+
+	if filter.From, err = timeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = timeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+	if filter.FromBlock, err = uintQuery(c, "from_block"); err != nil {
+		return filter, err
+	}
+	if filter.ToBlock, err = uintQuery(c, "to_block"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// addressQuery reads an optional address, it is returned in the stored lowercase format
+func addressQuery(c *fiber.Ctx, key string) (string, error) {
+	value := c.Query(key)
+	if value == "" {
+		return "", nil
+	}
+	return normalizeAddress(key, value)
+}
+
+// normalizeAddress validates the address given in the named parameter and returns it in the stored lowercase format
+func normalizeAddress(key string, value string) (string, error) {
+	address, err := ethaddr.Normalize(value)
+	if err != nil {
+		return "", apierror.BadRequest(key + " must be a 0x prefixed hex address of 20 bytes")
+	}
+	return address, nil
+}
+
+// uintQuery reads an optional non negative integer
+func uintQuery(c *fiber.Ctx, key string) (*uint64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, apierror.BadRequest(key + " must be a non negative integer")
+	}
+	return &n, nil
+}
+
+// levelQuery reads an optional referral level from 1 up to MaxReferralLevel
+func levelQuery(c *fiber.Ctx) (*uint8, error) {
+	value := c.Query("level")
+	if value == "" {
+		return nil, nil
+	}
+	level, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || level < 1 || level > lftdb.MaxReferralLevel {
+		return nil, apierror.BadRequest(fmt.Sprintf("level must be between 1 and %d", lftdb.MaxReferralLevel))
+	}
+	l := uint8(level)
+	return &l, nil
+}
+
+// amountQuery reads an optional non negative decimal token amount in wei
+func amountQuery(c *fiber.Ctx, key string) (string, error) {
+	value := c.Query(key)
+	if value == "" {
+		return "", nil
+	}
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok || amount.Sign() < 0 {
+		return "", apierror.BadRequest(key + " must be a non negative integer amount in wei")
+	}
+	return amount.String(), nil
+}
+
+// amountRangeQuery reads optional min and max amounts with the given prefix
+func amountRangeQuery(c *fiber.Ctx, prefix string) (string, string, error) {
+	min, err := amountQuery(c, "min_"+prefix)
+	if err != nil {
+		return "", "", err
+	}
+	max, err := amountQuery(c, "max_"+prefix)
+	return min, max, err
+}
+
+// pageQuery reads limit, order and cursor of list pagination, newest events are returned first by default
+func pageQuery(c *fiber.Ctx) (lftdb.Page, error) {
+	page := lftdb.Page{Order: lftdb.OrderDesc}
+
+	limit, err := limitQuery(c)
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+
+	switch order := c.Query("order", lftdb.OrderDesc); order {
+	case lftdb.OrderAsc, lftdb.OrderDesc:
+		page.Order = order
+	default:
+		return page, apierror.BadRequest("order must be one of: asc, desc")
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := lftdb.ParsePageCursor(value)
+		if err != nil {
+			return page, apierror.BadRequest("cursor must be a next_cursor value of the previous page")
+		}
+		page.Cursor = &cursor
+	}
+	return page, nil
+}
+
+// limitQuery reads the page size of lists
+func limitQuery(c *fiber.Ctx) (int, error) {
+	value := c.Query("limit")
+	if value == "" {
+		return lftdb.DefaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > lftdb.MaxPageLimit {
+		return 0, apierror.BadRequest(fmt.Sprintf("limit must be between 1 and %d", lftdb.MaxPageLimit))
+	}
+	return limit, nil
+}
+
+// deploymentQuery reads chain_id and contract filters, events of every deployment match by default
+func deploymentQuery(c *fiber.Ctx) (lftdb.Deployment, error) {
+	var d lftdb.Deployment
+	if value := c.Query("chain_id"); value != "" {
+		chainID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return d, apierror.BadRequest("chain_id must be a positive integer")
+		}
+		d.ChainID = chainID
+	}
+	if value := c.Query("contract"); value != "" {
+		address, err := normalizeAddress("contract", value)
+		if err != nil {
+			return d, err
+		}
+		d.ContractAddress = address
+	}
+	return d, nil
+}
+
+// statusQuery reads event status filter, only confirmed events are returned by default
+func statusQuery(c *fiber.Ctx) (string, error) {
+	status := c.Query("status", lftdb.StatusConfirmed)
+	switch status {
+	case lftdb.StatusConfirmed, lftdb.StatusPending, lftdb.StatusAll:
+		return status, nil
+	}
+	return "", apierror.BadRequest("status must be one of: confirmed, pending, all")
+}
+
+// timeQuery reads time given either as unix seconds or in RFC3339 format
+func timeQuery(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(seconds, 0).UTC()
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apierror.BadRequest(key + " must be unix seconds or RFC3339 time")
+	}
+	return &t, nil
+}
+
+// idParam reads the record id from the route
+func idParam(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, apierror.BadRequest("id must be a positive integer")
+	}
+	return uint(id), nil
+}
+
+// addressParam reads the address from the route, it is returned in the stored lowercase format
+func addressParam(c *fiber.Ctx) (string, error) {
+	return normalizeAddress("address", c.Params("address"))
+}
+
+// recordError converts the error of a single record query to the API error
+func recordError(err error, name string) error {
+	if errors.Is(err, lftdb.ErrNotFound) {
+		return apierror.NotFound(name + " not found")
+	}
+	return apierror.Internal(err)
+}
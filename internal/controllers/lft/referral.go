@@ -0,0 +1,106 @@
+package lftcontrollers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+type ReferralUplineResponse struct {
+	Address string                 `json:"address"`
+	Upline  []lftdb.ReferralMember `json:"upline"`
+}
+
+type ReferralDownlineResponse struct {
+	Address     string                     `json:"address"`
+	Levels      []lftdb.ReferralLevelCount `json:"levels"`
+	SubtreeSize int64                      `json:"subtree_size"`
+}
+
+// referralFilterQuery reads deployment and registration status filters of referral trees
+func referralFilterQuery(c *fiber.Ctx) (lftdb.ReferralFilter, error) {
+	var filter lftdb.ReferralFilter
+	deployment, err := deploymentQuery(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Deployment = deployment
+	filter.Status, err = statusQuery(c)
+	return filter, err
+}
+
+// GetReferralUpline returns referrers of the trader up to the fifth level
+func GetReferralUpline(c *fiber.Ctx) error {
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	filter, err := referralFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	upline, err := lftdb.GetReferralUpline(filter, address)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(ReferralUplineResponse{Address: address, Upline: upline})
+}
+
+// GetReferralDownline returns numbers of referred accounts per level and the size of the whole subtree
+func GetReferralDownline(c *fiber.Ctx) error {
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	filter, err := referralFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	levels, err := lftdb.GetReferralDownlineCounts(filter, address)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	size, err := lftdb.GetReferralSubtreeSize(filter, address)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(ReferralDownlineResponse{Address: address, Levels: levels, SubtreeSize: size})
+}
+
+// GetReferralDownlineLevel returns a page of accounts referred by the address at the level
+func GetReferralDownlineLevel(c *fiber.Ctx) error {
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	level, err := strconv.ParseUint(c.Params("level"), 10, 8)
+	if err != nil || level < 1 || level > lftdb.MaxReferralLevel {
+		return apierror.BadRequest(fmt.Sprintf("level must be between 1 and %d", lftdb.MaxReferralLevel))
+	}
+	filter, err := referralFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	limit, err := limitQuery(c)
+	if err != nil {
+		return err
+	}
+	var cursor *lftdb.ReferralCursor
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := lftdb.ParseReferralCursor(value)
+		if err != nil {
+			return apierror.BadRequest("cursor must be a next_cursor value of the previous page")
+		}
+		cursor = &parsed
+	}
+
+	members, err := lftdb.GetReferralDownline(filter, address, uint8(level), cursor, limit)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(members)
+}
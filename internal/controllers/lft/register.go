@@ -3,18 +3,41 @@ package lftcontrollers
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/sedyukov/lft-backend/internal/apierror"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
 )
 
 func GetAllRegister(c *fiber.Ctx) error {
-	var rs = lftdb.GetAllRegister()
-	c.JSON(rs)
-	return nil
+	eventFilter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	filter := lftdb.RegisterFilter{EventFilter: eventFilter}
+	if filter.Refferal, err = addressQuery(c, "referral"); err != nil {
+		return err
+	}
+	if filter.Trader, err = addressQuery(c, "trader"); err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	rs, err := lftdb.GetAllRegister(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(rs)
 }
 
 func GetRegister(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var r = lftdb.GetRegister(id)
-	c.JSON(r)
-	return nil
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	r, err := lftdb.GetRegister(id)
+	if err != nil {
+		return recordError(err, "register")
+	}
+	return c.JSON(r)
 }
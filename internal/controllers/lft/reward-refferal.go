@@ -1,21 +1,12 @@
 package lftcontrollers
 
 import (
-	"math/big"
-
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/sedyukov/lft-backend/internal/apierror"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
 )
 
-type RewardReferralEvent struct {
-	Trader      string   `json:"trader"`
-	Refferal    string   `json:"refferal"`
-	Level       uint8    `json:"level"`
-	Amount      *big.Int `json:"amount"`
-	BlockNumber uint64   `json:"block_number"`
-}
-
 type RewardRefferalSumResponse struct {
 	Referral string `json:"refferal"`
 	Sum      string `json:"amount"`
@@ -27,51 +18,86 @@ type RewardsRefferalSumWithLevelsResponse struct {
 }
 
 func GetAllRewardReferral(c *fiber.Ctx) error {
-	var rrs = lftdb.GetAllRewardReferral()
-	c.JSON(rrs)
-	return nil
+	eventFilter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	filter := lftdb.RewardReferralFilter{EventFilter: eventFilter}
+	if filter.Trader, err = addressQuery(c, "trader"); err != nil {
+		return err
+	}
+	if filter.Refferal, err = addressQuery(c, "refferal"); err != nil {
+		return err
+	}
+	if filter.Level, err = levelQuery(c); err != nil {
+		return err
+	}
+	if filter.MinAmount, filter.MaxAmount, err = amountRangeQuery(c, "amount"); err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	rrs, err := lftdb.GetAllRewardReferral(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(rrs)
 }
 
 func GetSumRewardsByRefAddress(c *fiber.Ctx) error {
-	address := c.Params("address")
-	sum := lftdb.GetSumRewardsByRefAddress(address)
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	deployment, err := deploymentQuery(c)
+	if err != nil {
+		return err
+	}
+	sum, err := lftdb.GetSumRewardsByRefAddress(lftdb.EventFilter{Deployment: deployment, Status: lftdb.StatusConfirmed}, address)
+	if err != nil {
+		return apierror.Internal(err)
+	}
 
 	res := RewardRefferalSumResponse{
 		Referral: address,
 		Sum:      sum,
 	}
 
-	c.JSON(res)
-	return nil
+	return c.JSON(res)
 }
 
 func GetSumRewardsByRefAddressWithLevels(c *fiber.Ctx) error {
-	address := c.Params("address")
-	dbRes := lftdb.GetSumRewardsByRefAddressAndLevels(address)
+	address, err := addressParam(c)
+	if err != nil {
+		return err
+	}
+	deployment, err := deploymentQuery(c)
+	if err != nil {
+		return err
+	}
+	dbRes, err := lftdb.GetSumRewardsByRefAddressAndLevels(lftdb.EventFilter{Deployment: deployment, Status: lftdb.StatusConfirmed}, address)
+	if err != nil {
+		return apierror.Internal(err)
+	}
 
 	res := RewardsRefferalSumWithLevelsResponse{
 		Referral: address,
 		Rewards:  dbRes,
 	}
 
-	c.JSON(res)
-	return nil
+	return c.JSON(res)
 }
 
 func GetRewardReferral(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var rr = lftdb.GetRewardReferral(id)
-	c.JSON(rr)
-	return nil
-}
-
-func CreateRewardRefferal(rre RewardReferralEvent) {
-	rr := lftdb.RewardReferral{
-		Trader:      rre.Trader,
-		Refferal:    rre.Refferal,
-		Level:       rre.Level,
-		Amount:      rre.Amount.String(),
-		BlockNumber: rre.BlockNumber,
-	}
-	lftdb.CreateRewardRefferal(rr)
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	rr, err := lftdb.GetRewardReferral(id)
+	if err != nil {
+		return recordError(err, "referral reward")
+	}
+	return c.JSON(rr)
 }
@@ -3,18 +3,38 @@ package lftcontrollers
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/sedyukov/lft-backend/internal/apierror"
 	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
 )
 
 func GetAllRewardStakers(c *fiber.Ctx) error {
-	var rss = lftdb.GetAllRewardStakers()
-	c.JSON(rss)
-	return nil
+	eventFilter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	filter := lftdb.RewardStakersFilter{EventFilter: eventFilter}
+	if filter.Trader, err = addressQuery(c, "trader"); err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	rss, err := lftdb.GetAllRewardStakers(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(rss)
 }
 
 func GetRewardStakers(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var rs = lftdb.GetRewardStakers(id)
-	c.JSON(rs)
-	return nil
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	rs, err := lftdb.GetRewardStakers(id)
+	if err != nil {
+		return recordError(err, "staker reward")
+	}
+	return c.JSON(rs)
 }
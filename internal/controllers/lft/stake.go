@@ -0,0 +1,43 @@
+package lftcontrollers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+func GetAllStake(c *fiber.Ctx) error {
+	eventFilter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	filter := lftdb.StakeFilter{EventFilter: eventFilter}
+	if filter.Staker, err = addressQuery(c, "staker"); err != nil {
+		return err
+	}
+	if filter.MinAmount, filter.MaxAmount, err = amountRangeQuery(c, "amount"); err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	ss, err := lftdb.GetAllStake(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(ss)
+}
+
+func GetStake(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	s, err := lftdb.GetStake(id)
+	if err != nil {
+		return recordError(err, "stake")
+	}
+	return c.JSON(s)
+}
@@ -0,0 +1,46 @@
+package lftcontrollers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+)
+
+func GetAllTransfer(c *fiber.Ctx) error {
+	eventFilter, err := eventFilterQuery(c)
+	if err != nil {
+		return err
+	}
+	filter := lftdb.TransferFilter{EventFilter: eventFilter}
+	if filter.From, err = addressQuery(c, "from_address"); err != nil {
+		return err
+	}
+	if filter.To, err = addressQuery(c, "to_address"); err != nil {
+		return err
+	}
+	if filter.MinValue, filter.MaxValue, err = amountRangeQuery(c, "value"); err != nil {
+		return err
+	}
+	page, err := pageQuery(c)
+	if err != nil {
+		return err
+	}
+	ts, err := lftdb.GetAllTransfer(filter, page)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	return c.JSON(ts)
+}
+
+func GetTransfer(c *fiber.Ctx) error {
+	id, err := idParam(c)
+	if err != nil {
+		return err
+	}
+	t, err := lftdb.GetTransfer(id)
+	if err != nil {
+		return recordError(err, "transfer")
+	}
+	return c.JSON(t)
+}
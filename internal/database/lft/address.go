@@ -0,0 +1,40 @@
+package lftdb
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lowercaseAddresses converts addresses stored in checksum format by earlier versions to lowercase,
+// rows which are already lowercase are not touched
+func lowercaseAddresses(db *DB) error {
+	return db.con.Transaction(func(tx *gorm.DB) error {
+		if err := lowercaseColumns(tx, &Block{}, "contract_address"); err != nil {
+			return err
+		}
+		for _, e := range eventModels {
+			if err := lowercaseColumns(tx, e.model, append([]string{"contract_address"}, e.addressColumns...)...); err != nil {
+				return err
+			}
+		}
+
+		// counter keys of deployments include the contract address
+		return tx.Unscoped().Model(&Counter{}).
+			Where("(key like ? or key like ?) and key <> lower(key)", blockCounterPrefix+":%", headCounterPrefix+":%").
+			Update("key", gorm.Expr("lower(key)")).Error
+	})
+}
+
+// lowercaseColumns converts values of the model columns to lowercase
+func lowercaseColumns(tx *gorm.DB, model interface{}, columns ...string) error {
+	for _, name := range columns {
+		column := clause.Column{Name: name}
+		err := tx.Unscoped().Model(model).
+			Where("? <> lower(?)", column, column).
+			Update(name, gorm.Expr("lower(?)", column)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
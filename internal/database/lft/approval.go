@@ -0,0 +1,15 @@
+package lftdb
+
+import (
+	"gorm.io/gorm"
+)
+
+type Approval struct {
+	gorm.Model
+	EventLog
+	Owner       string `json:"owner"`
+	Spender     string `json:"spender"`
+	Value       string `json:"value"`
+	BlockHeight int64  `json:"block_height" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
+}
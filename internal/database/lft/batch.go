@@ -0,0 +1,318 @@
+package lftdb
+
+import (
+	"math/big"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Batch holds events of a block range which are stored atomically with the block cursor
+type Batch struct {
+	Deployment            Deployment
+	Approvals             []Approval
+	OwnershipTransferreds []OwnershipTransferred
+	Registers             []Register
+	RewardReferrals       []RewardReferral
+	RewardStakers         []RewardStakers
+	Stakes                []Stake
+	Transfers             []Transfer
+	Unstakes              []Unstake
+	// Block is the last block of the range, its hash is used for reorganization detection
+	Block Block
+}
+
+// Len returns the number of events in the batch
+func (b Batch) Len() int {
+	return len(b.Approvals) +
+		len(b.OwnershipTransferreds) +
+		len(b.Registers) +
+		len(b.RewardReferrals) +
+		len(b.RewardStakers) +
+		len(b.Stakes) +
+		len(b.Transfers) +
+		len(b.Unstakes)
+}
+
+// Append adds events of another batch
+func (b *Batch) Append(other Batch) {
+	b.Approvals = append(b.Approvals, other.Approvals...)
+	b.OwnershipTransferreds = append(b.OwnershipTransferreds, other.OwnershipTransferreds...)
+	b.Registers = append(b.Registers, other.Registers...)
+	b.RewardReferrals = append(b.RewardReferrals, other.RewardReferrals...)
+	b.RewardStakers = append(b.RewardStakers, other.RewardStakers...)
+	b.Stakes = append(b.Stakes, other.Stakes...)
+	b.Transfers = append(b.Transfers, other.Transfers...)
+	b.Unstakes = append(b.Unstakes, other.Unstakes...)
+}
+
+type TransferEvent struct {
+	EventLog
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Value       *big.Int `json:"value"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateTransfer adds the event to the batch stored by the monitor
+func CreateTransfer(batch *Batch, te TransferEvent) {
+	t := Transfer{
+		EventLog:    te.EventLog,
+		From:        te.From,
+		To:          te.To,
+		Value:       te.Value.String(),
+		BlockHeight: int64(te.BlockNumber),
+		Status:      te.Status,
+	}
+	batch.Transfers = append(batch.Transfers, t)
+}
+
+type ApprovalEvent struct {
+	EventLog
+	Owner       string   `json:"owner"`
+	Spender     string   `json:"spender"`
+	Value       *big.Int `json:"value"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateApproval adds the event to the batch stored by the monitor
+func CreateApproval(batch *Batch, ae ApprovalEvent) {
+	a := Approval{
+		EventLog:    ae.EventLog,
+		Owner:       ae.Owner,
+		Spender:     ae.Spender,
+		Value:       ae.Value.String(),
+		BlockHeight: int64(ae.BlockNumber),
+		Status:      ae.Status,
+	}
+	batch.Approvals = append(batch.Approvals, a)
+}
+
+type RegisterEvent struct {
+	EventLog
+	Refferal    string `json:"refferal"`
+	Trader      string `json:"trader"`
+	BlockNumber uint64 `json:"block_number"`
+	Status      string `json:"status"`
+}
+
+// CreateRegister adds the event to the batch stored by the monitor
+func CreateRegister(batch *Batch, re RegisterEvent) {
+	r := Register{
+		EventLog:    re.EventLog,
+		Refferal:    re.Refferal,
+		Trader:      re.Trader,
+		BlockHeight: int64(re.BlockNumber),
+		Status:      re.Status,
+	}
+	batch.Registers = append(batch.Registers, r)
+}
+
+type StakeEvent struct {
+	EventLog
+	Staker      string   `json:"staker"`
+	Amount      *big.Int `json:"amount"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateStake adds the event to the batch stored by the monitor
+func CreateStake(batch *Batch, se StakeEvent) {
+	s := Stake{
+		EventLog:    se.EventLog,
+		Staker:      se.Staker,
+		Amount:      se.Amount.String(),
+		BlockHeight: int64(se.BlockNumber),
+		Status:      se.Status,
+	}
+	batch.Stakes = append(batch.Stakes, s)
+}
+
+type UnstakeEvent struct {
+	EventLog
+	Staker      string   `json:"staker"`
+	Amount      *big.Int `json:"amount"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateUnstake adds the event to the batch stored by the monitor
+func CreateUnstake(batch *Batch, ue UnstakeEvent) {
+	u := Unstake{
+		EventLog:    ue.EventLog,
+		Staker:      ue.Staker,
+		Amount:      ue.Amount.String(),
+		BlockHeight: int64(ue.BlockNumber),
+		Status:      ue.Status,
+	}
+	batch.Unstakes = append(batch.Unstakes, u)
+}
+
+type RewardReferralEvent struct {
+	EventLog
+	Trader      string   `json:"trader"`
+	Refferal    string   `json:"refferal"`
+	Level       uint8    `json:"level"`
+	Amount      *big.Int `json:"amount"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateRewardRefferal adds the event to the batch stored by the monitor
+func CreateRewardRefferal(batch *Batch, rre RewardReferralEvent) {
+	rr := RewardReferral{
+		EventLog:    rre.EventLog,
+		Trader:      rre.Trader,
+		Refferal:    rre.Refferal,
+		Level:       rre.Level,
+		Amount:      rre.Amount.String(),
+		BlockNumber: rre.BlockNumber,
+		Status:      rre.Status,
+	}
+	batch.RewardReferrals = append(batch.RewardReferrals, rr)
+}
+
+type RewardStakersEvent struct {
+	EventLog
+	Trader      string   `json:"trader"`
+	Amount      *big.Int `json:"amount"`
+	BlockNumber uint64   `json:"block_number"`
+	Status      string   `json:"status"`
+}
+
+// CreateRewardStakers adds the event to the batch stored by the monitor
+func CreateRewardStakers(batch *Batch, rse RewardStakersEvent) {
+	rs := RewardStakers{
+		EventLog:    rse.EventLog,
+		Trader:      rse.Trader,
+		Amount:      rse.Amount.String(),
+		BlockHeight: int64(rse.BlockNumber),
+		Status:      rse.Status,
+	}
+	batch.RewardStakers = append(batch.RewardStakers, rs)
+}
+
+type OwnershipTransferredEvent struct {
+	EventLog
+	PreviousOwner string `json:"previous_owner"`
+	NewOwner      string `json:"new_owner"`
+	BlockNumber   uint64 `json:"block_number"`
+	Status        string `json:"status"`
+}
+
+// CreateOwnershipTransferred adds the event to the batch stored by the monitor
+func CreateOwnershipTransferred(batch *Batch, ote OwnershipTransferredEvent) {
+	ot := OwnershipTransferred{
+		EventLog:    ote.EventLog,
+		OldOwner:    ote.PreviousOwner,
+		NewOwner:    ote.NewOwner,
+		BlockHeight: int64(ote.BlockNumber),
+		Status:      ote.Status,
+	}
+	batch.OwnershipTransferreds = append(batch.OwnershipTransferreds, ot)
+}
+
+// CommitBatch stores all batch events, the last block hash and moves block cursor in one transaction
+func CommitBatch(b Batch) error {
+	db := DBInstance.con
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := createRecords(tx, b.Approvals); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.OwnershipTransferreds); err != nil {
+			return err
+		}
+		registers := append(append([]Register(nil), b.Registers...), initialRegisters(b.Transfers)...)
+		if err := createRecords(tx, registers); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.RewardReferrals); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.RewardStakers); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.Stakes); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.Transfers); err != nil {
+			return err
+		}
+		if err := createRecords(tx, b.Unstakes); err != nil {
+			return err
+		}
+		block := b.Block
+		block.ChainID = b.Deployment.ChainID
+		block.ContractAddress = b.Deployment.ContractAddress
+		if err := saveBlock(tx, block); err != nil {
+			return err
+		}
+		return updateLastBlock(tx, b.Deployment, strconv.FormatUint(block.Number, 10))
+	})
+}
+
+// createRecords upserts records by (chain_id, tx_hash, log_index) skipping empty slices,
+// so the same block range can be processed more than once
+func createRecords[T any](tx *gorm.DB, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "tx_hash"}, {Name: "log_index"}},
+		UpdateAll: true,
+	}).Create(&records).Error
+}
+
+// removeUnidentifiedEvents deletes events stored by earlier versions without tx_hash, NULL values never
+// conflict in the upsert index so they would be duplicated when their blocks are processed again.
+// Block counters are rewound to the first block of deleted events, so they are indexed again with the log identity
+func removeUnidentifiedEvents(db *DB) error {
+	return db.con.Transaction(func(tx *gorm.DB) error {
+		rewind := make(map[string]uint64)
+		for _, e := range eventModels {
+			var rows []struct {
+				ChainID         *uint64
+				ContractAddress *string
+				Block           uint64
+			}
+			err := tx.Unscoped().Model(e.model).
+				Select("chain_id, contract_address, min(" + e.blockColumn + ") AS block").
+				Where("tx_hash IS NULL").
+				Group("chain_id, contract_address").
+				Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				continue
+			}
+
+			for _, r := range rows {
+				// untagged rows belong to the legacy counter which is adopted later by the deployment
+				key := legacyBlockKey
+				if r.ChainID != nil && *r.ChainID != 0 && r.ContractAddress != nil {
+					key = Deployment{ChainID: *r.ChainID, ContractAddress: *r.ContractAddress}.counterKey()
+				}
+				if block, ok := rewind[key]; !ok || r.Block < block {
+					rewind[key] = r.Block
+				}
+			}
+			if err = tx.Unscoped().Where("tx_hash IS NULL").Delete(e.model).Error; err != nil {
+				return err
+			}
+		}
+
+		for key, block := range rewind {
+			err := tx.Model(&Counter{}).
+				Where("key = ? AND value::numeric > ?", key, block).
+				Update("value", strconv.FormatUint(block, 10)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
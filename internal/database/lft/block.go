@@ -0,0 +1,65 @@
+package lftdb
+
+import (
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Block keeps hashes of processed blocks to detect chain reorganizations
+type Block struct {
+	gorm.Model
+	ChainID         uint64 `json:"chain_id" gorm:"uniqueIndex:,composite:deployment_number"`
+	ContractAddress string `json:"contract_address" gorm:"uniqueIndex:,composite:deployment_number"`
+	Number          uint64 `json:"number" gorm:"uniqueIndex:,composite:deployment_number"`
+	Hash            string `json:"hash"`
+	ParentHash      string `json:"parent_hash"`
+}
+
+func saveBlock(tx *gorm.DB, b Block) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract_address"}, {Name: "number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash", "parent_hash", "updated_at"}),
+	}).Create(&b).Error
+}
+
+// GetBlock returns stored block of the deployment by number, second value is false if block is not stored
+func GetBlock(d Deployment, number uint64) (Block, bool) {
+	db := DBInstance.con
+	var b Block
+	res := db.Scopes(d.scope).Where("number = ?", number).Limit(1).Find(&b)
+	return b, res.Error == nil && res.RowsAffected > 0
+}
+
+// GetBlocksDesc returns stored blocks in [from, to] ordered from the highest one
+func GetBlocksDesc(d Deployment, from uint64, to uint64) ([]Block, error) {
+	db := DBInstance.con
+	var bs []Block
+	err := db.Scopes(d.scope).Where("number >= ? and number <= ?", from, to).Order("number desc").Find(&bs).Error
+	return bs, err
+}
+
+// PruneBlocks removes stored blocks below number, they are too deep to be reorganized
+func PruneBlocks(d Deployment, number uint64) error {
+	db := DBInstance.con
+	return db.Unscoped().Scopes(d.scope).Where("number < ?", number).Delete(&Block{}).Error
+}
+
+// Rollback removes every event and block of the deployment stored above forkBlock and rewinds its block counter
+func Rollback(d Deployment, forkBlock uint64) error {
+	db := DBInstance.con
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, e := range eventModels {
+			err := tx.Unscoped().Scopes(d.scope).Where(e.blockColumn+" > ?", forkBlock).Delete(e.model).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Unscoped().Scopes(d.scope).Where("number > ?", forkBlock).Delete(&Block{}).Error
+		if err != nil {
+			return err
+		}
+		return updateLastBlock(tx, d, strconv.FormatUint(forkBlock, 10))
+	})
+}
@@ -1,6 +1,9 @@
 package lftdb
 
 import (
+	"strconv"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -15,20 +18,129 @@ func CreateCounter(c Counter) {
 	db.Create(&c)
 }
 
-func GetLastBlock() string {
+// legacyBlockKey is the single block counter used before indexing of several deployments
+const legacyBlockKey = "block"
+
+// InitLastBlock creates the block counter of the deployment starting from the given block,
+// existing counter is kept
+func InitLastBlock(d Deployment, start uint64) error {
+	db := DBInstance.con
+	var count int64
+	err := db.Model(&Counter{}).Where("key = ?", d.counterKey()).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return db.Create(&Counter{Key: d.counterKey(), Value: strconv.FormatUint(start, 10)}).Error
+}
+
+// AdoptLegacyLastBlock hands the legacy block counter over to the deployment together with stored
+// events and blocks which are not tagged with a deployment yet, false is returned if there is nothing to adopt.
+// Deployment columns were added to existing tables without a default, so untagged rows hold NULL
+func AdoptLegacyLastBlock(d Deployment) (bool, error) {
+	db := DBInstance.con
+	adopted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Counter{}).Where("key = ?", d.counterKey()).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+
+		res := tx.Model(&Counter{}).Where("key = ?", legacyBlockKey).Update("key", d.counterKey())
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		tag := map[string]interface{}{"chain_id": d.ChainID, "contract_address": d.ContractAddress}
+		for _, e := range eventModels {
+			err := tx.Model(e.model).Where("chain_id IS NULL OR chain_id = 0").Updates(tag).Error
+			if err != nil {
+				return err
+			}
+		}
+		adopted = true
+		return tx.Model(&Block{}).Where("chain_id IS NULL OR chain_id = 0").Updates(tag).Error
+	})
+	return adopted && err == nil, err
+}
+
+// GetLastBlock returns the last processed block of the deployment, second value is false if the counter is not set
+func GetLastBlock(d Deployment) (uint64, bool) {
 	db := DBInstance.con
 	var res Counter
 
-	db.Table("counters").Select("value").Where("key = ?", "block").Scan(&res)
-	if res.Value == "" {
-		panic("Start block not defined")
+	db.Table("counters").Select("value").Where("key = ?", d.counterKey()).Scan(&res)
+	block, err := strconv.ParseUint(res.Value, 10, 64)
+	if err != nil {
+		return 0, false
 	}
 
-	return res.Value
+	return block, true
 }
 
-func UpdateLastBlock(block string) {
+func UpdateLastBlock(d Deployment, block string) error {
 	db := DBInstance.con
+	return updateLastBlock(db, d, block)
+}
 
-	db.Table("counters").Where("key = ?", "block").Update("value", block)
+func updateLastBlock(tx *gorm.DB, d Deployment, block string) error {
+	return tx.Table("counters").Where("key = ?", d.counterKey()).Update("value", block).Error
+}
+
+// UpdateHead stores the latest chain head seen by the monitor of the deployment
+func UpdateHead(d Deployment, head uint64) error {
+	db := DBInstance.con
+	value := strconv.FormatUint(head, 10)
+	// updated_at of the head counter tells readiness checks when the parser saw the chain last time
+	res := db.Model(&Counter{}).Where("key = ?", d.headCounterKey()).Update("value", value)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return db.Create(&Counter{Key: d.headCounterKey(), Value: value}).Error
+}
+
+// IndexerState is the indexing progress of a deployment
+type IndexerState struct {
+	Deployment
+	IndexedBlock uint64
+	// Head is the latest chain head seen by the parser, 0 when unknown
+	Head uint64
+	// HeadUpdatedAt is the last time the parser requested the chain head
+	HeadUpdatedAt time.Time
+}
+
+// GetIndexerStates returns indexing progress of every deployment with a block counter
+func GetIndexerStates() ([]IndexerState, error) {
+	db := DBInstance.con
+	var counters []Counter
+	err := db.Where("key like ? or key like ?", blockCounterPrefix+":%", headCounterPrefix+":%").
+		Order("key").
+		Find(&counters).Error
+	if err != nil {
+		return nil, err
+	}
+
+	heads := make(map[Deployment]Counter)
+	var states []IndexerState
+	for _, c := range counters {
+		prefix, d, ok := parseCounterKey(c.Key)
+		value, err := strconv.ParseUint(c.Value, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		if prefix == headCounterPrefix {
+			heads[d] = c
+		} else {
+			states = append(states, IndexerState{Deployment: d, IndexedBlock: value})
+		}
+	}
+	for i := range states {
+		head, ok := heads[states[i].Deployment]
+		if !ok {
+			continue
+		}
+		states[i].Head, _ = strconv.ParseUint(head.Value, 10, 64)
+		states[i].HeadUpdatedAt = head.UpdatedAt
+	}
+	return states, nil
 }
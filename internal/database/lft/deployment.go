@@ -0,0 +1,54 @@
+package lftdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Deployment identifies indexed contract deployment on a chain
+type Deployment struct {
+	ChainID         uint64
+	ContractAddress string
+}
+
+// scope limits query to the deployment, empty fields are not filtered
+func (d Deployment) scope(db *gorm.DB) *gorm.DB {
+	if d.ChainID != 0 {
+		db = db.Where("chain_id = ?", d.ChainID)
+	}
+	if d.ContractAddress != "" {
+		db = db.Where("contract_address = ?", d.ContractAddress)
+	}
+	return db
+}
+
+const (
+	blockCounterPrefix = "block"
+	headCounterPrefix  = "head"
+)
+
+// counterKey returns the counters key holding the last processed block of the deployment
+func (d Deployment) counterKey() string {
+	return fmt.Sprintf("%s:%d:%s", blockCounterPrefix, d.ChainID, d.ContractAddress)
+}
+
+// headCounterKey returns the counters key holding the latest chain head seen by the deployment monitor
+func (d Deployment) headCounterKey() string {
+	return fmt.Sprintf("%s:%d:%s", headCounterPrefix, d.ChainID, d.ContractAddress)
+}
+
+// parseCounterKey splits the counters key of a deployment into its prefix and deployment
+func parseCounterKey(key string) (string, Deployment, bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 3 {
+		return "", Deployment{}, false
+	}
+	chainID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", Deployment{}, false
+	}
+	return parts[0], Deployment{ChainID: chainID, ContractAddress: parts[2]}, true
+}
@@ -0,0 +1,151 @@
+package lftdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusAll       = "all"
+)
+
+// ErrNotFound is returned when the requested record is not stored
+var ErrNotFound = errors.New("record not found")
+
+// EventLog identifies the log which emitted the event on chain
+type EventLog struct {
+	ChainID         uint64    `json:"chain_id" gorm:"uniqueIndex:,composite:chain_tx_log,priority:1;index:,composite:deployment"`
+	ContractAddress string    `json:"contract_address" gorm:"index:,composite:deployment"`
+	TxHash          string    `json:"tx_hash" gorm:"uniqueIndex:,composite:chain_tx_log,priority:2"`
+	LogIndex        uint      `json:"log_index" gorm:"uniqueIndex:,composite:chain_tx_log,priority:3;index:,composite:block_log,priority:2"`
+	TxIndex         uint      `json:"tx_index"`
+	BlockHash       string    `json:"block_hash"`
+	BlockTime       time.Time `json:"block_time" gorm:"index"`
+}
+
+// eventModels lists stored contract events with the column holding their block number
+// and columns holding addresses of accounts taking part in the event
+var eventModels = []struct {
+	model          interface{}
+	blockColumn    string
+	addressColumns []string
+}{
+	{&Approval{}, "block_height", []string{"owner", "spender"}},
+	{&OwnershipTransferred{}, "block_height", []string{"old_owner", "new_owner"}},
+	{&Register{}, "block_height", []string{"refferal", "trader"}},
+	{&RewardReferral{}, "block_number", []string{"trader", "refferal"}},
+	{&RewardStakers{}, "block_height", []string{"trader"}},
+	{&Stake{}, "block_height", []string{"staker"}},
+	{&Transfer{}, "block_height", []string{"from", "to"}},
+	{&Unstake{}, "block_height", []string{"staker"}},
+}
+
+// ConfirmEvents marks pending events of the deployment up to the given block as confirmed
+func ConfirmEvents(d Deployment, block uint64) error {
+	db := DBInstance.con
+	for _, e := range eventModels {
+		err := db.Model(e.model).
+			Scopes(d.scope).
+			Where("status = ? and "+e.blockColumn+" <= ?", StatusPending, block).
+			Update("status", StatusConfirmed).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventFilter limits events returned by list queries
+type EventFilter struct {
+	Deployment
+	// Status of events, StatusAll disables filtering
+	Status    string
+	From      *time.Time
+	To        *time.Time
+	FromBlock *uint64
+	ToBlock   *uint64
+}
+
+// apply adds filter conditions to the query of events with block number in blockColumn
+func (f EventFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.Deployment.scope(db)
+	if f.Status != "" && f.Status != StatusAll {
+		db = db.Where("status = ?", f.Status)
+	}
+	if f.From != nil {
+		db = db.Where("block_time >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("block_time <= ?", *f.To)
+	}
+	if f.FromBlock != nil {
+		db = db.Where(blockColumn+" >= ?", *f.FromBlock)
+	}
+	if f.ToBlock != nil {
+		db = db.Where(blockColumn+" <= ?", *f.ToBlock)
+	}
+	return db
+}
+
+// whereEq adds equality condition on the column when the value is set
+func whereEq(db *gorm.DB, column string, value string) *gorm.DB {
+	if value == "" {
+		return db
+	}
+	return db.Where(clause.Eq{Column: clause.Column{Name: column}, Value: value})
+}
+
+// amountColumns lists columns filtered by whereAmountRange, they are indexed by the numeric value
+var amountColumns = []struct {
+	model  interface{}
+	column string
+}{
+	{&RewardReferral{}, "amount"},
+	{&Stake{}, "amount"},
+	{&Transfer{}, "value"},
+}
+
+// createAmountIndexes adds expression indexes matching conditions of whereAmountRange
+func createAmountIndexes(db *DB) error {
+	for _, a := range amountColumns {
+		stmt := &gorm.Statement{DB: db.con}
+		if err := stmt.Parse(a.model); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+		err := db.con.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s_numeric ON %s ((%s::numeric))",
+			table, a.column, table, a.column)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// whereAmountRange limits decimal amount stored as string in the column by inclusive bounds when they are set
+func whereAmountRange(db *gorm.DB, column string, min string, max string) *gorm.DB {
+	if min != "" {
+		db = db.Where(column+"::numeric >= ?::numeric", min)
+	}
+	if max != "" {
+		db = db.Where(column+"::numeric <= ?::numeric", max)
+	}
+	return db
+}
+
+// getByID returns the stored record by its id or ErrNotFound
+func getByID[T any](id uint) (T, error) {
+	db := DBInstance.con
+	var record T
+	err := db.First(&record, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrNotFound
+	}
+	return record, err
+}
@@ -25,6 +25,8 @@ func InitDatabase(logger zerolog.Logger, autoMigrate bool) error {
 	if autoMigrate {
 		logger.Info().Msg("DB migration started")
 		err := db.con.AutoMigrate(
+			&Approval{},
+			&Block{},
 			&OwnershipTransferred{},
 			&Register{},
 			&RewardReferral{},
@@ -37,6 +39,26 @@ func InitDatabase(logger zerolog.Logger, autoMigrate bool) error {
 		if err != nil {
 			return err
 		}
+		err = removeUnidentifiedEvents(db)
+		if err != nil {
+			return err
+		}
+		err = lowercaseAddresses(db)
+		if err != nil {
+			return err
+		}
+		err = restoreInitialRegisters(db)
+		if err != nil {
+			return err
+		}
+		err = createAmountIndexes(db)
+		if err != nil {
+			return err
+		}
+		err = createReferralLeaderboard(db)
+		if err != nil {
+			return err
+		}
 		logger.Info().Msg("DB migration finished")
 	}
 	DBInstance = db
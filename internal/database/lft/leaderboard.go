@@ -0,0 +1,111 @@
+package lftdb
+
+import (
+	"context"
+	"time"
+)
+
+// Periods of the referral leaderboard counted back from the last refresh
+const (
+	PeriodDay   = "24h"
+	PeriodWeek  = "7d"
+	PeriodMonth = "30d"
+	PeriodAll   = "all"
+)
+
+const referralLeaderboardView = "referral_leaderboard"
+
+// referralLeaderboardSQL aggregates confirmed referral rewards per period, deployment, referrer and level,
+// level 0 holds totals of all levels
+const referralLeaderboardSQL = `CREATE MATERIALIZED VIEW IF NOT EXISTS ` + referralLeaderboardView + ` AS
+SELECT p.period, r.chain_id, r.contract_address, r.refferal,
+	CASE WHEN GROUPING(r.level) = 1 THEN 0 ELSE r.level END AS level,
+	sum(r.amount::numeric) AS amount, count(*) AS count, now() AS refreshed_at
+FROM reward_referrals r
+JOIN (VALUES
+	('` + PeriodDay + `', interval '24 hours'),
+	('` + PeriodWeek + `', interval '7 days'),
+	('` + PeriodMonth + `', interval '30 days'),
+	('` + PeriodAll + `', NULL::interval)
+) p(period, length) ON p.length IS NULL OR r.block_time >= now() - p.length
+WHERE r.status = '` + StatusConfirmed + `' AND r.deleted_at IS NULL
+GROUP BY GROUPING SETS (
+	(p.period, r.chain_id, r.contract_address, r.refferal, r.level),
+	(p.period, r.chain_id, r.contract_address, r.refferal)
+)`
+
+// createReferralLeaderboard creates the leaderboard view with the unique index required by concurrent refresh
+func createReferralLeaderboard(db *DB) error {
+	if err := db.con.Exec(referralLeaderboardSQL).Error; err != nil {
+		return err
+	}
+	return db.con.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_` + referralLeaderboardView + `_key
+ON ` + referralLeaderboardView + ` (period, level, chain_id, contract_address, refferal)`).Error
+}
+
+// RefreshReferralLeaderboard recalculates the leaderboard view without blocking reads
+func RefreshReferralLeaderboard(ctx context.Context) error {
+	db := DBInstance.con
+	return db.WithContext(ctx).Exec(`REFRESH MATERIALIZED VIEW CONCURRENTLY ` + referralLeaderboardView).Error
+}
+
+// LeaderboardFilter selects the leaderboard period, referral level and deployments
+type LeaderboardFilter struct {
+	Deployment
+	Period string
+	// Level of rewards, 0 counts rewards of all levels
+	Level uint8
+}
+
+type LeaderboardEntry struct {
+	Rank    uint64 `json:"rank"`
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Count   uint64 `json:"count"`
+	// Share of the address in rewards of all referrers
+	Share float64 `json:"share"`
+}
+
+type Leaderboard struct {
+	Period      string             `json:"period"`
+	Level       uint8              `json:"level"`
+	TotalAmount string             `json:"total_amount"`
+	RefreshedAt *time.Time         `json:"refreshed_at"`
+	Data        []LeaderboardEntry `json:"data"`
+}
+
+// GetReferralLeaderboard returns referrers with the largest rewards from the last refreshed leaderboard
+func GetReferralLeaderboard(filter LeaderboardFilter, limit int) (Leaderboard, error) {
+	db := DBInstance.con
+	res := Leaderboard{Period: filter.Period, Level: filter.Level, TotalAmount: "0", Data: []LeaderboardEntry{}}
+
+	var rows []struct {
+		LeaderboardEntry
+		TotalAmount string
+		RefreshedAt time.Time
+	}
+	err := db.Table(referralLeaderboardView).
+		Scopes(filter.Deployment.scope).
+		Select(`refferal AS address, sum(amount) AS amount, sum(count)::bigint AS count,
+			rank() OVER (ORDER BY sum(amount) DESC) AS rank,
+			(sum(amount) / nullif(sum(sum(amount)) OVER (), 0))::float8 AS share,
+			sum(sum(amount)) OVER () AS total_amount,
+			max(max(refreshed_at)) OVER () AS refreshed_at`).
+		Where("period = ? AND level = ?", filter.Period, filter.Level).
+		Group("refferal").
+		Order("amount DESC, address").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return res, err
+	}
+
+	for _, r := range rows {
+		res.Data = append(res.Data, r.LeaderboardEntry)
+	}
+	if len(rows) > 0 {
+		res.TotalAmount = rows[0].TotalAmount
+		res.RefreshedAt = &rows[0].RefreshedAt
+	}
+	return res, nil
+}
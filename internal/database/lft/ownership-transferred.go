@@ -6,21 +6,22 @@ import (
 
 type OwnershipTransferred struct {
 	gorm.Model
+	EventLog
 	OldOwner    string `json:"old_owner"`
 	NewOwner    string `json:"new_owner"`
-	BlockHeight int64  `json:"block_height"`
+	BlockHeight int64  `json:"block_height" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
-func GetAllOwnershipTransferred() []OwnershipTransferred {
+func GetAllOwnershipTransferred(filter EventFilter, page Page) (PageResult[OwnershipTransferred], error) {
 	db := DBInstance.con
-	var ots []OwnershipTransferred
-	db.Find(&ots)
-	return ots
+	return findPage[OwnershipTransferred](db, "block_height", filter, page)
 }
 
-func GetOwnershipTransferred(id string) OwnershipTransferred {
-	db := DBInstance.con
-	var ot OwnershipTransferred
-	db.First(&ot, id)
-	return ot
+func (ot OwnershipTransferred) pageCursor() PageCursor {
+	return PageCursor{Block: uint64(ot.BlockHeight), LogIndex: ot.LogIndex, ID: ot.ID}
+}
+
+func GetOwnershipTransferred(id uint) (OwnershipTransferred, error) {
+	return getByID[OwnershipTransferred](id)
 }
@@ -0,0 +1,118 @@
+package lftdb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects a part of ordered list query results
+type Page struct {
+	Limit int
+	// Order of events by block and log index, OrderAsc or OrderDesc
+	Order string
+	// Cursor points to the last event of the previous page, nil for the first page
+	Cursor *PageCursor
+}
+
+// PageCursor is the position of an event in lists ordered by block number, log index and id
+type PageCursor struct {
+	Block    uint64
+	LogIndex uint
+	ID       uint
+}
+
+// String encodes the cursor for query parameters
+func (c PageCursor) String() string {
+	raw := fmt.Sprintf("%d:%d:%d", c.Block, c.LogIndex, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParsePageCursor decodes the cursor returned as next_cursor
+func ParsePageCursor(value string) (PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	var values [3]uint64
+	for i, part := range parts {
+		if values[i], err = strconv.ParseUint(part, 10, 64); err != nil {
+			return PageCursor{}, ErrInvalidCursor
+		}
+	}
+	return PageCursor{Block: values[0], LogIndex: uint(values[1]), ID: uint(values[2])}, nil
+}
+
+// PageResult is a page of list query results with the cursor of the next page
+// and the total number of results matching the query
+type PageResult[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int64  `json:"total"`
+}
+
+// pageItem is an event which can be paginated
+type pageItem interface {
+	pageCursor() PageCursor
+}
+
+// eventQuery adds filter conditions to the query of events with block number in blockColumn
+type eventQuery interface {
+	apply(db *gorm.DB, blockColumn string) *gorm.DB
+}
+
+// findPage runs the filtered query of events with block number in blockColumn
+// using keyset pagination on (block, log_index, id)
+func findPage[T pageItem](db *gorm.DB, blockColumn string, filter eventQuery, page Page) (PageResult[T], error) {
+	res := PageResult[T]{Data: []T{}}
+	db = filter.apply(db.Model(new(T)), blockColumn).Session(&gorm.Session{})
+
+	if err := db.Count(&res.Total).Error; err != nil {
+		return res, err
+	}
+
+	limit := page.Limit
+	if limit <= 0 || limit > MaxPageLimit {
+		limit = DefaultPageLimit
+	}
+	order, cmp := OrderAsc, ">"
+	if page.Order == OrderDesc {
+		order, cmp = OrderDesc, "<"
+	}
+
+	query := db
+	if c := page.Cursor; c != nil {
+		query = query.Where(fmt.Sprintf("(%s, log_index, id) %s (?, ?, ?)", blockColumn, cmp), c.Block, c.LogIndex, c.ID)
+	}
+	err := query.
+		Order(fmt.Sprintf("%[1]s %[2]s, log_index %[2]s, id %[2]s", blockColumn, order)).
+		Limit(limit + 1).
+		Find(&res.Data).Error
+	if err != nil {
+		return res, err
+	}
+
+	if len(res.Data) > limit {
+		res.Data = res.Data[:limit]
+		res.NextCursor = res.Data[limit-1].pageCursor().String()
+	}
+	return res, nil
+}
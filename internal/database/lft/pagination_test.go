@@ -0,0 +1,19 @@
+package lftdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageCursor(t *testing.T) {
+	cursor := PageCursor{Block: 26544123, LogIndex: 17, ID: 90210}
+	parsed, err := ParsePageCursor(cursor.String())
+	require.NoError(t, err)
+	require.Equal(t, cursor, parsed)
+
+	for _, value := range []string{"", "not base64!", "MTox", "YTpiOmM"} {
+		_, err = ParsePageCursor(value)
+		require.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
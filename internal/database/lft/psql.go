@@ -1,6 +1,7 @@
 package lftdb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -54,6 +55,11 @@ func NewDB(config Config, logger zerolog.Logger) (*DB, error) {
 	}, nil
 }
 
+// Ping checks the database connection
+func (db *DB) Ping(ctx context.Context) error {
+	return db.sqlDB.PingContext(ctx)
+}
+
 func (db *DB) Close() error {
 	return db.sqlDB.Close()
 }
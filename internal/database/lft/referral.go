@@ -0,0 +1,258 @@
+package lftdb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxReferralLevel is the depth of the referral chain kept by the contract for every trader
+	MaxReferralLevel = 5
+
+	zeroAddress = "0x0000000000000000000000000000000000000000"
+)
+
+// referralEdgesSQL defines the edges CTE holding referral and trader pairs of every registration
+// together with the event position and the position of the next registration of the trader, which
+// replaces the referral chain stored by the contract. Referral chains of traders are copied from the
+// referrer at registration, so ancestors are resolved by edges valid at the position of the child.
+// Expects the subquery of registers as the argument.
+const referralEdgesSQL = `registered AS (?),
+edges AS (
+	SELECT chain_id, contract_address, refferal, trader, block_height, log_index,
+		lead(block_height) OVER w AS until_block, lead(log_index) OVER w AS until_log
+	FROM registered
+	WINDOW w AS (PARTITION BY chain_id, contract_address, trader ORDER BY block_height, log_index)
+)`
+
+// ReferralFilter limits registrations used to build referral trees
+type ReferralFilter struct {
+	Deployment
+	// Status of registrations, StatusAll disables filtering
+	Status string
+}
+
+// ReferralMember is an account of the referral tree at the level relative to the requested address
+type ReferralMember struct {
+	ChainID         uint64 `json:"chain_id"`
+	ContractAddress string `json:"contract_address"`
+	Address         string `json:"address"`
+	Level           uint8  `json:"level"`
+}
+
+// ReferralLevelCount is the number of downline accounts at the level
+type ReferralLevelCount struct {
+	Level uint8 `json:"level"`
+	Count int64 `json:"count"`
+}
+
+// referralEdgesArgs returns arguments of referralEdgesSQL
+func (f ReferralFilter) referralEdgesArgs(db *gorm.DB) []interface{} {
+	filter := EventFilter{Deployment: f.Deployment, Status: f.Status}
+	registers := filter.apply(db.Model(&Register{}), "block_height").
+		Select("chain_id, contract_address, refferal, trader, block_height, log_index")
+	return []interface{}{registers}
+}
+
+// initialRegisters returns registrations made by the contract constructor without Register events,
+// the deployer refers the first initial referral and every next one is referred by the previous.
+// They are restored from the mint, which happens only in the constructor, and the following transfers
+// of the deployer in the same transaction and keep the identity of those transfers
+func initialRegisters(transfers []Transfer) []Register {
+	type txKey struct {
+		chainID uint64
+		txHash  string
+	}
+	sorted := append([]Transfer(nil), transfers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BlockHeight != sorted[j].BlockHeight {
+			return sorted[i].BlockHeight < sorted[j].BlockHeight
+		}
+		return sorted[i].LogIndex < sorted[j].LogIndex
+	})
+
+	deployers := make(map[txKey]string)
+	refs := make(map[txKey][]string)
+	var res []Register
+	for _, t := range sorted {
+		key := txKey{chainID: t.ChainID, txHash: t.TxHash}
+		if t.From == zeroAddress {
+			deployers[key] = t.To
+			continue
+		}
+		deployer, ok := deployers[key]
+		if !ok || t.From != deployer || len(refs[key]) == MaxReferralLevel {
+			continue
+		}
+		refferal := deployer
+		if n := len(refs[key]); n > 0 {
+			refferal = refs[key][n-1]
+		}
+		refs[key] = append(refs[key], t.To)
+		res = append(res, Register{
+			EventLog:    t.EventLog,
+			Refferal:    refferal,
+			Trader:      t.To,
+			BlockHeight: t.BlockHeight,
+			Status:      t.Status,
+		})
+	}
+	return res
+}
+
+// restoreInitialRegisters stores constructor registrations of deployments indexed before they were
+// derived from transfers, the mint is the only transfer from the zero address so the scan is short
+func restoreInitialRegisters(db *DB) error {
+	var transfers []Transfer
+	err := db.con.
+		Where("(chain_id, tx_hash) IN (?)",
+			db.con.Model(&Transfer{}).Select("chain_id, tx_hash").Where(`"from" = ?`, zeroAddress)).
+		Find(&transfers).Error
+	if err != nil {
+		return err
+	}
+	return createRecords(db.con, initialRegisters(transfers))
+}
+
+// GetReferralUpline returns referrers of the trader ordered from the direct one up to MaxReferralLevel
+func GetReferralUpline(filter ReferralFilter, trader string) ([]ReferralMember, error) {
+	db := DBInstance.con
+	res := []ReferralMember{}
+	err := db.Raw(`WITH RECURSIVE `+referralEdgesSQL+`,
+upline AS (
+	SELECT chain_id, contract_address, refferal AS address, block_height, log_index, 1 AS level
+	FROM edges
+	WHERE trader = ? AND until_block IS NULL
+	UNION ALL
+	SELECT e.chain_id, e.contract_address, e.refferal, e.block_height, e.log_index, u.level + 1
+	FROM upline u
+	JOIN edges e ON e.chain_id = u.chain_id AND e.contract_address = u.contract_address AND e.trader = u.address
+		AND (e.block_height, e.log_index) < (u.block_height, u.log_index)
+		AND (e.until_block IS NULL OR (e.until_block, e.until_log) > (u.block_height, u.log_index))
+	WHERE u.level < ?
+)
+SELECT chain_id, contract_address, address, level FROM upline
+ORDER BY chain_id, contract_address, level`,
+		append(filter.referralEdgesArgs(db), trader, MaxReferralLevel)...).
+		Scan(&res).Error
+	return res, err
+}
+
+// downlineSQL selects from the downline CTE holding edges of accounts referred by the address directly
+// or through other accounts up to the given level, edges replaced by later registrations are kept to
+// resolve children registered before the replacement and are skipped by selects with until_block IS NULL
+const downlineSQL = `WITH RECURSIVE ` + referralEdgesSQL + `,
+downline AS (
+	SELECT chain_id, contract_address, trader AS address, block_height, log_index, until_block, until_log, 1 AS level
+	FROM edges
+	WHERE refferal = ?
+	UNION ALL
+	SELECT e.chain_id, e.contract_address, e.trader, e.block_height, e.log_index, e.until_block, e.until_log, d.level + 1
+	FROM downline d
+	JOIN edges e ON e.chain_id = d.chain_id AND e.contract_address = d.contract_address AND e.refferal = d.address
+		AND (e.block_height, e.log_index) > (d.block_height, d.log_index)
+		AND (d.until_block IS NULL OR (e.block_height, e.log_index) < (d.until_block, d.until_log))
+	WHERE d.level < ?
+)
+`
+
+// GetReferralDownlineCounts returns numbers of accounts referred by the referrer at every level
+// up to MaxReferralLevel, levels without accounts are omitted
+func GetReferralDownlineCounts(filter ReferralFilter, refferal string) ([]ReferralLevelCount, error) {
+	db := DBInstance.con
+	res := []ReferralLevelCount{}
+	err := db.Raw(downlineSQL+`SELECT level, count(*) AS count FROM downline WHERE until_block IS NULL GROUP BY level ORDER BY level`,
+		append(filter.referralEdgesArgs(db), refferal, MaxReferralLevel)...).
+		Scan(&res).Error
+	return res, err
+}
+
+// GetReferralSubtreeSize returns the number of all accounts referred by the referrer at any depth
+func GetReferralSubtreeSize(filter ReferralFilter, refferal string) (int64, error) {
+	db := DBInstance.con
+	var size int64
+	// positions of edges grow with the level, so the depth is limited only by the number of registrations
+	err := db.Raw(downlineSQL+`SELECT count(DISTINCT (chain_id, contract_address, address)) FROM downline WHERE until_block IS NULL AND address <> ?`,
+		append(filter.referralEdgesArgs(db), refferal, math.MaxInt32, refferal)...).
+		Scan(&size).Error
+	return size, err
+}
+
+// ReferralCursor is the position of an account in downline lists ordered by address and deployment
+type ReferralCursor struct {
+	Address         string
+	ChainID         uint64
+	ContractAddress string
+}
+
+// String encodes the cursor for query parameters
+func (c ReferralCursor) String() string {
+	raw := fmt.Sprintf("%s:%d:%s", c.Address, c.ChainID, c.ContractAddress)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseReferralCursor decodes the cursor returned as next_cursor of downline lists
+func ParseReferralCursor(value string) (ReferralCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ReferralCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return ReferralCursor{}, ErrInvalidCursor
+	}
+	chainID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return ReferralCursor{}, ErrInvalidCursor
+	}
+	return ReferralCursor{Address: parts[0], ChainID: chainID, ContractAddress: parts[2]}, nil
+}
+
+// GetReferralDownline returns a page of accounts referred by the referrer at the level ordered by address,
+// the cursor points to the last account of the previous page, nil for the first page
+func GetReferralDownline(filter ReferralFilter, refferal string, level uint8, cursor *ReferralCursor, limit int) (PageResult[ReferralMember], error) {
+	db := DBInstance.con
+	res := PageResult[ReferralMember]{Data: []ReferralMember{}}
+	if cursor == nil {
+		cursor = &ReferralCursor{}
+	}
+
+	type row struct {
+		ReferralMember
+		Total int64
+	}
+	var rows []row
+	err := db.Raw(downlineSQL+`, members AS (
+	SELECT chain_id, contract_address, address, level FROM downline
+	WHERE level = ? AND until_block IS NULL
+)
+SELECT *, (SELECT count(*) FROM members) AS total FROM members
+WHERE (address, chain_id, contract_address) > (?, ?, ?)
+ORDER BY address, chain_id, contract_address
+LIMIT ?`,
+		append(filter.referralEdgesArgs(db), refferal, level, level,
+			cursor.Address, cursor.ChainID, cursor.ContractAddress, limit+1)...).
+		Scan(&rows).Error
+	if err != nil {
+		return res, err
+	}
+
+	for i, r := range rows {
+		if i == limit {
+			last := res.Data[limit-1]
+			res.NextCursor = ReferralCursor{Address: last.Address, ChainID: last.ChainID, ContractAddress: last.ContractAddress}.String()
+			break
+		}
+		res.Data = append(res.Data, r.ReferralMember)
+	}
+	if len(rows) > 0 {
+		res.Total = rows[0].Total
+	}
+	return res, nil
+}
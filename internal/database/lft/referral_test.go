@@ -0,0 +1,137 @@
+package lftdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestReferralCursor(t *testing.T) {
+	cursor := ReferralCursor{
+		Address:         "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed",
+		ChainID:         56,
+		ContractAddress: "0xfb6115445bff7b52feb98650c87f44907e58f802",
+	}
+	parsed, err := ParseReferralCursor(cursor.String())
+	require.NoError(t, err)
+	require.Equal(t, cursor, parsed)
+
+	for _, value := range []string{"", "not base64!", "MTox", "YTpiOmM"} {
+		_, err = ParseReferralCursor(value)
+		require.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
+
+func TestInitialRegisters(t *testing.T) {
+	transfer := func(logIndex uint, from, to string) Transfer {
+		return Transfer{
+			EventLog:    EventLog{ChainID: 56, TxHash: "0xdeploy", LogIndex: logIndex},
+			From:        from,
+			To:          to,
+			BlockHeight: 100,
+			Status:      StatusConfirmed,
+		}
+	}
+	transfers := []Transfer{
+		// logs of other transactions and of the deployer after the initial referrals are ignored
+		{EventLog: EventLog{ChainID: 56, TxHash: "0xother", LogIndex: 0}, From: "0xd", To: "0xx", BlockHeight: 99},
+		transfer(6, "0xd", "0xr4"),
+		transfer(0, zeroAddress, "0xd"),
+		transfer(2, "0xd", "0xr0"),
+		transfer(3, "0xd", "0xr1"),
+		transfer(4, "0xd", "0xr2"),
+		transfer(5, "0xd", "0xr3"),
+		transfer(7, "0xd", "0xy"),
+	}
+
+	registers := initialRegisters(transfers)
+	require.Len(t, registers, MaxReferralLevel)
+	pairs := make([][2]string, 0, len(registers))
+	for _, r := range registers {
+		require.Equal(t, "0xdeploy", r.TxHash)
+		require.Equal(t, StatusConfirmed, r.Status)
+		pairs = append(pairs, [2]string{r.Refferal, r.Trader})
+	}
+	require.Equal(t, [][2]string{
+		{"0xd", "0xr0"}, {"0xr0", "0xr1"}, {"0xr1", "0xr2"}, {"0xr2", "0xr3"}, {"0xr3", "0xr4"},
+	}, pairs)
+	require.Equal(t, uint(6), registers[4].LogIndex)
+
+	require.Empty(t, initialRegisters(transfers[:1]))
+}
+
+// TestReferralTree runs referral queries against the database from LFT_TEST_PSQL_DSN in a rolled back transaction
+func TestReferralTree(t *testing.T) {
+	dsn := os.Getenv("LFT_TEST_PSQL_DSN")
+	if dsn == "" {
+		t.Skip("LFT_TEST_PSQL_DSN is not set")
+	}
+	con, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	tx := con.Begin()
+	defer tx.Rollback()
+	previous := DBInstance
+	DBInstance = &DB{con: tx}
+	defer func() { DBInstance = previous }()
+	require.NoError(t, tx.AutoMigrate(&Register{}))
+
+	register := func(block int64, refferal, trader string) Register {
+		return Register{
+			EventLog:    EventLog{ChainID: 56, ContractAddress: "0xc", TxHash: fmt.Sprintf("0x%d", block)},
+			Refferal:    refferal,
+			Trader:      trader,
+			BlockHeight: block,
+			Status:      StatusConfirmed,
+		}
+	}
+	registers := []Register{
+		register(1, "0xd", "0xr0"),
+		register(2, "0xr0", "0xr1"),
+		register(3, "0xr1", "0xr2"),
+		register(4, "0xr2", "0xr3"),
+		register(5, "0xr3", "0xr4"),
+		register(6, "0xr4", "0xa"),
+		register(7, "0xa", "0xb"),
+		// the later registration of 0xa doesn't change the chain copied by 0xb
+		register(8, "0xd", "0xa"),
+	}
+	require.NoError(t, createRecords(tx, registers))
+	filter := ReferralFilter{Status: StatusAll}
+
+	upline, err := GetReferralUpline(filter, "0xb")
+	require.NoError(t, err)
+	addresses := make([]string, 0, len(upline))
+	for i, m := range upline {
+		require.Equal(t, uint8(i+1), m.Level)
+		addresses = append(addresses, m.Address)
+	}
+	require.Equal(t, []string{"0xa", "0xr4", "0xr3", "0xr2", "0xr1"}, addresses)
+
+	counts, err := GetReferralDownlineCounts(filter, "0xd")
+	require.NoError(t, err)
+	require.Equal(t, []ReferralLevelCount{{1, 2}, {2, 1}, {3, 1}, {4, 1}, {5, 1}}, counts)
+
+	// 0xa left the downline of 0xr3, 0xb registered before that and stays at the third level
+	counts, err = GetReferralDownlineCounts(filter, "0xr3")
+	require.NoError(t, err)
+	require.Equal(t, []ReferralLevelCount{{1, 1}, {3, 1}}, counts)
+
+	size, err := GetReferralSubtreeSize(filter, "0xr0")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), size)
+
+	page, err := GetReferralDownline(filter, "0xd", 1, nil, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), page.Total)
+	require.Equal(t, "0xa", page.Data[0].Address)
+	cursor, err := ParseReferralCursor(page.NextCursor)
+	require.NoError(t, err)
+	page, err = GetReferralDownline(filter, "0xd", 1, &cursor, 1)
+	require.NoError(t, err)
+	require.Equal(t, "0xr0", page.Data[0].Address)
+	require.Empty(t, page.NextCursor)
+}
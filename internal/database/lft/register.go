@@ -6,21 +6,35 @@ import (
 
 type Register struct {
 	gorm.Model
-	Refferal    string `json:"refferal"`
-	Trader      string `json:"trader"`
-	BlockHeight int64  `json:"block_height"`
+	EventLog
+	Refferal    string `json:"refferal" gorm:"index"`
+	Trader      string `json:"trader" gorm:"index"`
+	BlockHeight int64  `json:"block_height" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
-func GetAllRegister() []Register {
-	db := DBInstance.con
-	var rs []Register
-	db.Find(&rs)
-	return rs
+// RegisterFilter limits registers returned by list queries
+type RegisterFilter struct {
+	EventFilter
+	Refferal string
+	Trader   string
+}
+
+func (f RegisterFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.EventFilter.apply(db, blockColumn)
+	db = whereEq(db, "refferal", f.Refferal)
+	return whereEq(db, "trader", f.Trader)
 }
 
-func GetRegister(id string) Register {
+func GetAllRegister(filter RegisterFilter, page Page) (PageResult[Register], error) {
 	db := DBInstance.con
-	var r Register
-	db.First(&r, id)
-	return r
+	return findPage[Register](db, "block_height", filter, page)
+}
+
+func (r Register) pageCursor() PageCursor {
+	return PageCursor{Block: uint64(r.BlockHeight), LogIndex: r.LogIndex, ID: r.ID}
+}
+
+func GetRegister(id uint) (Register, error) {
+	return getByID[Register](id)
 }
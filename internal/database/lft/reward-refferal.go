@@ -6,11 +6,13 @@ import (
 
 type RewardReferral struct {
 	gorm.Model
-	Trader      string `json:"trader"`
-	Refferal    string `json:"refferal"`
-	Level       uint8  `json:"level"`
+	EventLog
+	Trader      string `json:"trader" gorm:"index"`
+	Refferal    string `json:"refferal" gorm:"index"`
+	Level       uint8  `json:"level" gorm:"index"`
 	Amount      string `json:"amount"`
-	BlockNumber uint64 `json:"block_number"`
+	BlockNumber uint64 `json:"block_number" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
 type RewardSumResult struct {
@@ -23,37 +25,63 @@ type RewardSumLevelsResult struct {
 	Count uint64 `json:"count"`
 }
 
-func GetSumRewardsByRefAddress(refferal string) string {
+// GetSumRewardsByRefAddress returns the total of referral rewards of the referrer
+func GetSumRewardsByRefAddress(filter EventFilter, refferal string) (string, error) {
 	db := DBInstance.con
-	var sum string
-	sql := "select sum(amount::numeric) from reward_referrals rr where refferal = ?"
-	db.Raw(sql, refferal).Scan(&sum)
-	return sum
+	var sum *string
+	err := filter.apply(db.Model(&RewardReferral{}), "block_number").
+		Select("sum(amount::numeric)").
+		Where("refferal = ?", refferal).
+		Scan(&sum).Error
+	if err != nil || sum == nil {
+		return "0", err
+	}
+	return *sum, nil
 }
 
-func GetSumRewardsByRefAddressAndLevels(refferal string) []RewardSumLevelsResult {
+// GetSumRewardsByRefAddressAndLevels returns totals and numbers of referral rewards of the referrer per level
+func GetSumRewardsByRefAddressAndLevels(filter EventFilter, refferal string) ([]RewardSumLevelsResult, error) {
 	db := DBInstance.con
-	var res []RewardSumLevelsResult
-	sql := "select level, sum(amount::numeric), count(amount) from reward_referrals rr where refferal = ? group by level"
-	db.Raw(sql, refferal).Scan(&res)
-	return res
+	res := []RewardSumLevelsResult{}
+	err := filter.apply(db.Model(&RewardReferral{}), "block_number").
+		Select("level, sum(amount::numeric) AS sum, count(amount) AS count").
+		Where("refferal = ?", refferal).
+		Group("level").
+		Order("level").
+		Scan(&res).Error
+	return res, err
 }
 
-func GetRewardReferral(id string) RewardReferral {
-	db := DBInstance.con
-	var rr RewardReferral
-	db.First(&rr, id)
-	return rr
+func GetRewardReferral(id uint) (RewardReferral, error) {
+	return getByID[RewardReferral](id)
 }
 
-func GetAllRewardReferral() []RewardReferral {
-	db := DBInstance.con
-	var rrs []RewardReferral
-	db.Find(&rrs)
-	return rrs
+// RewardReferralFilter limits referral rewards returned by list queries
+type RewardReferralFilter struct {
+	EventFilter
+	Trader   string
+	Refferal string
+	Level    *uint8
+	// MinAmount and MaxAmount are inclusive decimal bounds of the amount
+	MinAmount string
+	MaxAmount string
+}
+
+func (f RewardReferralFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.EventFilter.apply(db, blockColumn)
+	db = whereEq(db, "trader", f.Trader)
+	db = whereEq(db, "refferal", f.Refferal)
+	if f.Level != nil {
+		db = db.Where("level = ?", *f.Level)
+	}
+	return whereAmountRange(db, "amount", f.MinAmount, f.MaxAmount)
 }
 
-func CreateRewardRefferal(rr RewardReferral) {
+func GetAllRewardReferral(filter RewardReferralFilter, page Page) (PageResult[RewardReferral], error) {
 	db := DBInstance.con
-	db.Create(&rr)
+	return findPage[RewardReferral](db, "block_number", filter, page)
+}
+
+func (rr RewardReferral) pageCursor() PageCursor {
+	return PageCursor{Block: rr.BlockNumber, LogIndex: rr.LogIndex, ID: rr.ID}
 }
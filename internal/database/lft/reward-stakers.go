@@ -6,21 +6,33 @@ import (
 
 type RewardStakers struct {
 	gorm.Model
-	Trader      string `json:"trader"`
+	EventLog
+	Trader      string `json:"trader" gorm:"index"`
 	Amount      string `json:"amount"`
-	BlockHeight int64  `json:"block_height"`
+	BlockHeight int64  `json:"block_height" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
-func GetAllRewardStakers() []RewardStakers {
-	db := DBInstance.con
-	var rss []RewardStakers
-	db.Find(&rss)
-	return rss
+// RewardStakersFilter limits staker rewards returned by list queries
+type RewardStakersFilter struct {
+	EventFilter
+	Trader string
+}
+
+func (f RewardStakersFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.EventFilter.apply(db, blockColumn)
+	return whereEq(db, "trader", f.Trader)
 }
 
-func GetRewardStakers(id string) RewardStakers {
+func GetAllRewardStakers(filter RewardStakersFilter, page Page) (PageResult[RewardStakers], error) {
 	db := DBInstance.con
-	var rs RewardStakers
-	db.First(&rs, id)
-	return rs
+	return findPage[RewardStakers](db, "block_height", filter, page)
+}
+
+func (rs RewardStakers) pageCursor() PageCursor {
+	return PageCursor{Block: uint64(rs.BlockHeight), LogIndex: rs.LogIndex, ID: rs.ID}
+}
+
+func GetRewardStakers(id uint) (RewardStakers, error) {
+	return getByID[RewardStakers](id)
 }
@@ -6,11 +6,37 @@ import (
 
 type Stake struct {
 	gorm.Model
-	Staker      string `json:"staker"`
+	EventLog
+	Staker      string `json:"staker" gorm:"index"`
 	Amount      string `json:"amount"`
-	BlockHeight int64  `json:"block_height"`
+	BlockHeight int64  `json:"block_height" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
-func CreateStake() {
+// StakeFilter limits stakes returned by list queries
+type StakeFilter struct {
+	EventFilter
+	Staker string
+	// MinAmount and MaxAmount are inclusive decimal bounds of the amount
+	MinAmount string
+	MaxAmount string
+}
+
+func (f StakeFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.EventFilter.apply(db, blockColumn)
+	db = whereEq(db, "staker", f.Staker)
+	return whereAmountRange(db, "amount", f.MinAmount, f.MaxAmount)
+}
+
+func GetAllStake(filter StakeFilter, page Page) (PageResult[Stake], error) {
+	db := DBInstance.con
+	return findPage[Stake](db, "block_height", filter, page)
+}
+
+func GetStake(id uint) (Stake, error) {
+	return getByID[Stake](id)
+}
 
+func (s Stake) pageCursor() PageCursor {
+	return PageCursor{Block: uint64(s.BlockHeight), LogIndex: s.LogIndex, ID: s.ID}
 }
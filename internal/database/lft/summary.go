@@ -0,0 +1,170 @@
+package lftdb
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddressActivity holds totals of events the address took part in
+type AddressActivity struct {
+	// StakersRewards is the total of rewards for stakers collected from trades of the address
+	StakersRewards string `json:"stakers_rewards"`
+	Staked         string `json:"staked"`
+	Unstaked       string `json:"unstaked"`
+	// CurrentStaked is the amount the address can unstake now, including stakers rewards accrued by its shares
+	CurrentStaked string  `json:"current_staked"`
+	FirstBlock    *uint64 `json:"first_block"`
+	LastBlock     *uint64 `json:"last_block"`
+}
+
+// GetAddressActivity returns totals of staking events and the range of blocks with events of the address
+func GetAddressActivity(filter EventFilter, address string) (AddressActivity, error) {
+	db := DBInstance.con
+	var res AddressActivity
+
+	args := []interface{}{
+		sumAmount(db, filter, &RewardStakers{}, "trader", address),
+		sumAmount(db, filter, &Stake{}, "staker", address),
+		sumAmount(db, filter, &Unstake{}, "staker", address),
+	}
+	blocks := make([]string, 0, len(eventModels))
+	for _, e := range eventModels {
+		conditions := make([]clause.Expression, 0, len(e.addressColumns))
+		for _, column := range e.addressColumns {
+			conditions = append(conditions, clause.Eq{Column: clause.Column{Name: column}, Value: address})
+		}
+		// single expression of clause.Or would be joined with the filter conditions by OR
+		var participant clause.Expression = clause.Or(conditions...)
+		if len(conditions) == 1 {
+			participant = conditions[0]
+		}
+		args = append(args, filter.apply(db.Model(e.model), e.blockColumn).
+			Select(fmt.Sprintf("min(%[1]s) AS first_block, max(%[1]s) AS last_block", e.blockColumn)).
+			Where(participant))
+		blocks = append(blocks, "(?)")
+	}
+
+	err := db.Raw(`SELECT (?) AS stakers_rewards, (?) AS staked, (?) AS unstaked,
+	min(first_block) AS first_block, max(last_block) AS last_block
+FROM (`+strings.Join(blocks, " UNION ALL ")+`) blocks`, args...).
+		Scan(&res).Error
+	if err != nil {
+		return res, err
+	}
+	res.CurrentStaked, err = currentStaked(db, filter, address)
+	return res, err
+}
+
+// stakeChange is a Stake or Unstake event with the staking pool balance after the event
+type stakeChange struct {
+	Staker  string
+	Amount  string
+	Unstake bool
+	Pool    string
+}
+
+// currentStaked returns the amount staked by the address in every deployment it staked in. The contract
+// converts staked amounts to shares of the pool, which is the contract balance, so shares are replayed
+// from all Stake and Unstake events of the deployment and the pool is restored from transfers to and
+// from the contract, they include stakers rewards. Only the deployment and status of the filter are used
+func currentStaked(db *gorm.DB, filter EventFilter, address string) (string, error) {
+	var deployments []Deployment
+	err := filter.Deployment.scope(db.Model(&Stake{})).
+		Distinct("chain_id", "contract_address").
+		Where("staker = ?", address).
+		Scan(&deployments).Error
+	if err != nil {
+		return "", err
+	}
+
+	total := new(big.Int)
+	for _, d := range deployments {
+		scoped := EventFilter{Deployment: d, Status: filter.Status}
+		changes := func(model interface{}) *gorm.DB {
+			return scoped.apply(db.Model(model), "block_height").
+				Select("block_height, log_index, staker, amount")
+		}
+		pool := scoped.apply(db.Model(&Transfer{}), "block_height").
+			Select(`block_height, log_index, "to", value`).
+			Where(`("to" = ? OR "from" = ?) AND "from" <> "to"`, d.ContractAddress, d.ContractAddress)
+
+		var rows []stakeChange
+		err = db.Raw(`WITH changes AS (
+	SELECT block_height, log_index, 0::numeric AS delta, staker, amount, false AS unstake FROM (?) s
+	UNION ALL
+	SELECT block_height, log_index, 0::numeric, staker, amount, true FROM (?) u
+	UNION ALL
+	SELECT block_height, log_index, CASE WHEN "to" = ? THEN value::numeric ELSE -value::numeric END, NULL, NULL, NULL FROM (?) t
+)
+SELECT staker, amount, unstake, sum(delta) OVER (ORDER BY block_height, log_index) AS pool
+FROM changes
+ORDER BY block_height, log_index`, changes(&Stake{}), changes(&Unstake{}), d.ContractAddress, pool).
+			Scan(&rows).Error
+		if err != nil {
+			return "", err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		// the last row holds the current pool balance, transfers are used only for it
+		balance := rows[len(rows)-1].Pool
+		var events []stakeChange
+		for _, r := range rows {
+			if r.Staker != "" {
+				events = append(events, r)
+			}
+		}
+		total.Add(total, stakedAmount(events, address, balance))
+	}
+	return total.String(), nil
+}
+
+// stakedAmount replays shares of Stake and Unstake events as the contract calculates them and returns
+// the amount of the pool owned by shares of the address. Pool balance of every event includes its own
+// transfer, which is emitted right before the event
+func stakedAmount(changes []stakeChange, address string, pool string) *big.Int {
+	shares, totalShare := new(big.Int), new(big.Int)
+	for _, c := range changes {
+		amount, ok := new(big.Int).SetString(c.Amount, 10)
+		if !ok {
+			continue
+		}
+		before, ok := new(big.Int).SetString(c.Pool, 10)
+		if !ok {
+			continue
+		}
+		share := new(big.Int).Set(amount)
+		if c.Unstake {
+			before.Add(before, amount)
+		} else {
+			before.Sub(before, amount)
+		}
+		if before.Sign() > 0 && totalShare.Sign() > 0 {
+			share.Mul(amount, totalShare).Quo(share, before)
+		}
+		if c.Unstake {
+			share.Neg(share)
+		}
+		totalShare.Add(totalShare, share)
+		if c.Staker == address {
+			shares.Add(shares, share)
+		}
+	}
+
+	balance, ok := new(big.Int).SetString(pool, 10)
+	if !ok || shares.Sign() <= 0 || totalShare.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return balance.Mul(balance, shares).Quo(balance, totalShare)
+}
+
+// sumAmount returns the subquery of the amounts total of the model events with the address in the column
+func sumAmount(db *gorm.DB, filter EventFilter, model interface{}, column string, address string) *gorm.DB {
+	return filter.apply(db.Model(model), "block_height").
+		Select("coalesce(sum(amount::numeric), 0)").
+		Where(clause.Eq{Column: clause.Column{Name: column}, Value: address})
+}
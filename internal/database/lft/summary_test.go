@@ -0,0 +1,22 @@
+package lftdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStakedAmount(t *testing.T) {
+	// pool balances include the transfer of the event itself, 50 of stakers rewards come before the second stake
+	changes := []stakeChange{
+		{Staker: "0xa", Amount: "100", Pool: "100"},
+		{Staker: "0xb", Amount: "150", Pool: "300"},
+		{Staker: "0xa", Amount: "60", Unstake: true, Pool: "240"},
+	}
+	require.Equal(t, "90", stakedAmount(changes, "0xa", "240").String())
+	require.Equal(t, "150", stakedAmount(changes, "0xb", "240").String())
+	// rewards after the last event are shared by current shares
+	require.Equal(t, "120", stakedAmount(changes, "0xa", "320").String())
+	require.Equal(t, "0", stakedAmount(changes, "0xc", "240").String())
+	require.Equal(t, "0", stakedAmount(nil, "0xa", "0").String())
+}
@@ -6,12 +6,40 @@ import (
 
 type Transfer struct {
 	gorm.Model
-	From        string `json:"from"`
-	To          string `json:"to"`
+	EventLog
+	From        string `json:"from" gorm:"index"`
+	To          string `json:"to" gorm:"index"`
 	Value       string `json:"value"`
-	BlockHeight int64  `json:"blockHeight"`
+	BlockHeight int64  `json:"blockHeight" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
 
-func CreateTransfer() {
+// TransferFilter limits transfers returned by list queries
+type TransferFilter struct {
+	EventFilter
+	From string
+	To   string
+	// MinValue and MaxValue are inclusive decimal bounds of the transferred value
+	MinValue string
+	MaxValue string
+}
+
+func (f TransferFilter) apply(db *gorm.DB, blockColumn string) *gorm.DB {
+	db = f.EventFilter.apply(db, blockColumn)
+	db = whereEq(db, "from", f.From)
+	db = whereEq(db, "to", f.To)
+	return whereAmountRange(db, "value", f.MinValue, f.MaxValue)
+}
+
+func GetAllTransfer(filter TransferFilter, page Page) (PageResult[Transfer], error) {
+	db := DBInstance.con
+	return findPage[Transfer](db, "block_height", filter, page)
+}
+
+func GetTransfer(id uint) (Transfer, error) {
+	return getByID[Transfer](id)
+}
 
+func (t Transfer) pageCursor() PageCursor {
+	return PageCursor{Block: uint64(t.BlockHeight), LogIndex: t.LogIndex, ID: t.ID}
 }
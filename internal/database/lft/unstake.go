@@ -6,11 +6,9 @@ import (
 
 type Unstake struct {
 	gorm.Model
+	EventLog
 	Staker      string `json:"staker"`
 	Amount      string `json:"amount"`
-	BlockHeight int64  `json:"blockHeight"`
-}
-
-func CreateUnstake() {
-
+	BlockHeight int64  `json:"blockHeight" gorm:"index:,composite:block_log,priority:1"`
+	Status      string `json:"status" gorm:"index;default:confirmed"`
 }
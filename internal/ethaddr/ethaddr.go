@@ -0,0 +1,34 @@
+package ethaddr
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+var addressRegex = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+// Validate checks the 0x prefixed hex address format
+func Validate(address string) error {
+	if !addressRegex.MatchString(address) {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// Normalize validates the address and returns it in the stored lowercase format
+func Normalize(address string) (string, error) {
+	if err := Validate(address); err != nil {
+		return "", err
+	}
+	return strings.ToLower(address), nil
+}
+
+// String returns the address in the stored lowercase format
+func String(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
@@ -0,0 +1,25 @@
+package ethaddr
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	checksum := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	lower := "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+
+	for _, value := range []string{checksum, lower, "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED"} {
+		normalized, err := Normalize(value)
+		require.NoError(t, err)
+		require.Equal(t, lower, normalized)
+	}
+	require.Equal(t, lower, String(common.HexToAddress(checksum)))
+
+	for _, value := range []string{"", "5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", "0xzzaeb6053f3e94c9b9a09f33669435e7ef1beaed"} {
+		_, err := Normalize(value)
+		require.ErrorIs(t, err, ErrInvalidAddress, value)
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	lftdb "github.com/sedyukov/lft-backend/internal/database/lft"
+	"github.com/sedyukov/lft-backend/internal/middleware"
+)
+
+const (
+	// DefaultMaxLag is the number of blocks the indexer may stay behind the chain head while ready
+	DefaultMaxLag = 100
+	// DefaultMaxHeadAge is how long ago the parser may have requested the chain head last time while ready
+	DefaultMaxHeadAge = 5 * time.Minute
+	// pingTimeout limits the database ping of readiness check
+	pingTimeout = 2 * time.Second
+
+	StatusOk          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Config holds readiness limits, zero values are replaced by defaults
+type Config struct {
+	MaxLag     uint64
+	MaxHeadAge time.Duration
+}
+
+// DeploymentState is the indexing progress of a deployment
+type DeploymentState struct {
+	ChainID       uint64    `json:"chain_id"`
+	Contract      string    `json:"contract"`
+	IndexedBlock  uint64    `json:"indexed_block"`
+	Head          uint64    `json:"head"`
+	HeadUpdatedAt time.Time `json:"head_updated_at"`
+	Lag           uint64    `json:"lag"`
+	Status        string    `json:"status"`
+}
+
+// Report is the readiness check result
+type Report struct {
+	Status      string            `json:"status"`
+	Database    string            `json:"database"`
+	Deployments []DeploymentState `json:"deployments"`
+}
+
+// Ready checks the database connection, the lag of every indexed deployment and the age of its chain head,
+// deployments without known chain head are not checked. Database error is returned to be logged,
+// the report holds only the status
+func Ready(ctx context.Context, config Config) (Report, error) {
+	if config.MaxLag == 0 {
+		config.MaxLag = DefaultMaxLag
+	}
+	if config.MaxHeadAge == 0 {
+		config.MaxHeadAge = DefaultMaxHeadAge
+	}
+	report := Report{Status: StatusOk, Database: StatusOk, Deployments: []DeploymentState{}}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := lftdb.DBInstance.Ping(ctx); err != nil {
+		report.Status, report.Database = StatusUnavailable, StatusUnavailable
+		return report, err
+	}
+
+	states, err := lftdb.GetIndexerStates()
+	if err != nil {
+		report.Status, report.Database = StatusUnavailable, StatusUnavailable
+		return report, err
+	}
+	for _, s := range states {
+		state := DeploymentState{
+			ChainID:       s.ChainID,
+			Contract:      s.ContractAddress,
+			IndexedBlock:  s.IndexedBlock,
+			Head:          s.Head,
+			HeadUpdatedAt: s.HeadUpdatedAt,
+			Status:        StatusOk,
+		}
+		if s.Head > s.IndexedBlock {
+			state.Lag = s.Head - s.IndexedBlock
+		}
+		// the stored head stops moving when the parser is down, so the lag alone can't show a stale index
+		stale := s.Head > 0 && time.Since(s.HeadUpdatedAt) > config.MaxHeadAge
+		if state.Lag > config.MaxLag || stale {
+			state.Status, report.Status = StatusUnavailable, StatusUnavailable
+		}
+		report.Deployments = append(report.Deployments, state)
+	}
+	return report, nil
+}
+
+func (r Report) httpStatus() int {
+	if r.Status == StatusOk {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// Healthz responds while the gateway process is alive
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusOk})
+}
+
+// Readyz responds with the readiness report, 503 status is returned when the gateway is not ready
+func Readyz(config Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report, err := Ready(c.UserContext(), config)
+		if err != nil {
+			logger := middleware.Logger(c)
+			logger.Error().Err(err).Msg("Readiness check failed")
+		}
+		return c.Status(report.httpStatus()).JSON(report)
+	}
+}
+
+// Register adds /healthz and /readyz handlers to the admin mux of the parser
+func Register(mux *http.ServeMux, config Config, logger zerolog.Logger) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOk})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report, err := Ready(r.Context(), config)
+		if err != nil {
+			logger.Error().Err(err).Msg("Readiness check failed")
+		}
+		writeJSON(w, report.httpStatus(), report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
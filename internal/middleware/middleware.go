@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+	"github.com/sedyukov/lft-backend/internal/apierror"
+)
+
+const (
+	metricsNamespace = "lft_gateway"
+	// loggerKey keeps the request logger in fiber locals
+	loggerKey = "logger"
+	// unmatchedRoute labels requests which didn't match any route
+	unmatchedRoute = "unmatched"
+)
+
+var (
+	requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of handled requests by route and status code",
+	}, []string{"method", "route", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of handled requests by route",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Setup registers request id, request logging and metrics middleware
+func Setup(app *fiber.App, logger zerolog.Logger) {
+	app.Use(requestid.New())
+	app.Use(requestLogger(logger))
+}
+
+// Logger returns the logger of the request with its request id attached
+func Logger(c *fiber.Ctx) zerolog.Logger {
+	if logger, ok := c.Locals(loggerKey).(zerolog.Logger); ok {
+		return logger
+	}
+	return zerolog.Nop()
+}
+
+// requestLogger attaches request id to the logger of the request,
+// logs every handled request and records its metrics
+func requestLogger(base zerolog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID, _ := c.Locals(requestid.ConfigDefault.ContextKey).(string)
+		logger := base.With().Str("request_id", requestID).Logger()
+		c.Locals(loggerKey, logger)
+
+		err := c.Next()
+
+		status := responseStatus(c, err)
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+			route = unmatchedRoute
+		}
+		latency := time.Since(start)
+		requestsCounter.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+		requestDuration.WithLabelValues(c.Method(), route).Observe(latency.Seconds())
+
+		event := logger.Info()
+		if status >= fiber.StatusInternalServerError {
+			event = logger.Error().Err(err)
+		}
+		event.Msgf("%s %s %d %s", c.Method(), c.OriginalURL(), status, latency)
+		return err
+	}
+}
+
+// responseStatus returns status code of the response including the one of returned error,
+// which is written later by the error handler
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	return apierror.From(err).Status
+}
+
+// ErrorHandler renders errors returned by handlers in the JSON error model,
+// causes of internal errors are logged by the request logger
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	apiErr := apierror.From(err)
+	requestID, _ := c.Locals(requestid.ConfigDefault.ContextKey).(string)
+	return c.Status(apiErr.Status).JSON(apierror.Response{
+		Error: apierror.ResponseError{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			RequestID: requestID,
+		},
+	})
+}
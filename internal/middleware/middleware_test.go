@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/sedyukov/lft-backend/internal/apierror"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	app := fiber.New()
+	Setup(app, zerolog.Nop())
+	app.Get("/api/v1/register/:id", func(c *fiber.Ctx) error {
+		require.NotEmpty(t, c.Locals("requestid"))
+		return c.SendString(c.Params("id"))
+	})
+
+	res, err := app.Test(httptest.NewRequest("GET", "/api/v1/register/1", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, res.StatusCode)
+	require.NotEmpty(t, res.Header.Get(fiber.HeaderXRequestID))
+	require.Equal(t, 1.0, testutil.ToFloat64(requestsCounter.WithLabelValues("GET", "/api/v1/register/:id", "200")))
+
+	res, err = app.Test(httptest.NewRequest("GET", "/missing", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, res.StatusCode)
+	require.Equal(t, 1.0, testutil.ToFloat64(requestsCounter.WithLabelValues("GET", unmatchedRoute, "404")))
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	Setup(app, zerolog.Nop())
+	app.Get("/bad", func(c *fiber.Ctx) error {
+		return apierror.BadRequest("id must be a positive integer")
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return errors.New("pq: relation \"registers\" does not exist")
+	})
+
+	for _, tc := range []struct {
+		path    string
+		status  int
+		code    string
+		message string
+	}{
+		{"/bad", fiber.StatusBadRequest, apierror.CodeBadRequest, "id must be a positive integer"},
+		{"/fail", fiber.StatusInternalServerError, apierror.CodeInternal, "internal server error"},
+		{"/missing", fiber.StatusNotFound, apierror.CodeNotFound, "Cannot GET /missing"},
+	} {
+		res, err := app.Test(httptest.NewRequest("GET", tc.path, nil))
+		require.NoError(t, err)
+		require.Equal(t, tc.status, res.StatusCode, tc.path)
+
+		var body apierror.Response
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		require.Equal(t, tc.code, body.Error.Code, tc.path)
+		require.Equal(t, tc.message, body.Error.Message, tc.path)
+		require.Equal(t, res.Header.Get(fiber.HeaderXRequestID), body.Error.RequestID, tc.path)
+	}
+}
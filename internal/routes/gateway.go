@@ -7,6 +7,9 @@ import (
 )
 
 func SetupGatewayRoutes(app *fiber.App) {
+	// address summary
+	app.Get("/api/v1/address/:address/summary", lftcontrollers.GetAddressSummary)
+
 	// ownership transferred
 	app.Get("/api/v1/ownership-transferred", lftcontrollers.GetAllOwnershipTransferred)
 	app.Get("/api/v1/ownership-transferred/:id", lftcontrollers.GetOwnershipTransferred)
@@ -21,7 +24,23 @@ func SetupGatewayRoutes(app *fiber.App) {
 	app.Get("/api/v1/rewards-sum/ref/:address", lftcontrollers.GetSumRewardsByRefAddress)
 	app.Get("/api/v1/rewards-sum-levels/ref/:address", lftcontrollers.GetSumRewardsByRefAddressWithLevels)
 
+	// referral tree
+	app.Get("/api/v1/referrals/:address/upline", lftcontrollers.GetReferralUpline)
+	app.Get("/api/v1/referrals/:address/downline", lftcontrollers.GetReferralDownline)
+	app.Get("/api/v1/referrals/:address/downline/:level", lftcontrollers.GetReferralDownlineLevel)
+
+	// leaderboard
+	app.Get("/api/v1/leaderboard/referrals", lftcontrollers.GetReferralLeaderboard)
+
 	// reward stakers
 	app.Get("/api/v1/reward-stakers", lftcontrollers.GetAllRewardStakers)
 	app.Get("/api/v1/reward-stakers/:id", lftcontrollers.GetRewardStakers)
+
+	// stake
+	app.Get("/api/v1/stake", lftcontrollers.GetAllStake)
+	app.Get("/api/v1/stake/:id", lftcontrollers.GetStake)
+
+	// transfer
+	app.Get("/api/v1/transfer", lftcontrollers.GetAllTransfer)
+	app.Get("/api/v1/transfer/:id", lftcontrollers.GetTransfer)
 }
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+)
+
+// adminShutdownTimeout limits waiting for open connections on shutdown
+const adminShutdownTimeout = 5 * time.Second
+
+// NewAdminMux returns handler of the admin port serving /metrics
+func NewAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// ServeAdmin serves the admin handler on the given port until the context is cancelled
+func ServeAdmin(ctx context.Context, port string, handler http.Handler, logger zerolog.Logger) {
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info().Msgf("Serving admin endpoints on port %v", port)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error().Err(err).Msg("Admin server failed")
+	}
+}